@@ -1,37 +1,34 @@
 package auth
 
 import (
-	"time"
-
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-
+// Encrypt hashes source with bcrypt.DefaultCost, use a PasswordManager to
+// hash with argon2id or scrypt. Despite its name it does not encrypt, use a
+// Cipher to encrypt data that must be decrypted again. It returns
+// ErrEmptyPassword or ErrPasswordTooLong like BcryptHasher.
 func Encrypt(source []byte) ([]byte, error) {
+	if err := checkHashable(source, MaxBcryptPasswordLength); err != nil {
+		return nil, err
+	}
+
 	return bcrypt.GenerateFromPassword(source, bcrypt.DefaultCost)
 }
 
+// Compare compares a bcrypt, argon2id or scrypt hashed password with its
+// possible plaintext equivalent. Returns nil on success, or an error on failure.
 func Compare(hashedPassword, password []byte) error {
-	return bcrypt.CompareHashAndPassword(hashedPassword, password)
-}
+	_, err := DefaultPasswordManager.Verify(string(hashedPassword), password)
 
-// Sign issue a jwt token based on secretId, secretKey, iss and aud
-func Sign(secretId, secretKey, iss, aud string) (string) {
-	claims := jwt.MapClaims{
-		"ext": time.Now().Add(time.Minute).Unix(),
-		"iat": time.Now().Unix(),
-        "nbf": time.Now().Unix(),
-		"aud": aud,go get -u github.com/tidwall/gjson
-		"iss": iss,
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.SigningMethodHS256, claims)
-	token.Header["kid"] = secretId
+	return err
+}
 
-	// Sign the token with the specified secret.
-	tokenString, _ := token.SignedString([]byte(secretKey))
+// Sign issue a jwt token based on secretId, secretKey, iss and aud.
+// It returns an empty string if the token can not be signed, use Issuer
+// to get the signing error.
+func Sign(secretId, secretKey, iss, aud string) string {
+	tokenString, _ := NewIssuer(secretId, secretKey, iss, aud).Issue()
 
 	return tokenString
-
-}
\ No newline at end of file
+}
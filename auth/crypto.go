@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/bxsec/gotool/util/aead"
+)
+
+// Define the errors returned by the crypto helpers.
+var (
+	ErrInvalidCiphertext  = aead.ErrInvalidCiphertext
+	ErrUnsupportedVersion = aead.ErrUnsupportedVersion
+	ErrDecryptFailed      = aead.ErrDecryptFailed
+	ErrSignatureMismatch  = errors.New("signature does not match")
+)
+
+// CipherAlgorithm is the AEAD of a ciphertext envelope.
+type CipherAlgorithm = aead.Algorithm
+
+// Define the cipher algorithms, both take 32 bytes keys.
+const (
+	XChaCha20Poly1305 = aead.XChaCha20Poly1305
+	AES256GCM         = aead.AES256GCM
+)
+
+// SymmetricKeySize is the size of the keys of a Cipher.
+const SymmetricKeySize = aead.KeySize
+
+// GenerateSymmetricKey returns a random key for NewCipher.
+func GenerateSymmetricKey() ([]byte, error) {
+	return aead.GenerateKey()
+}
+
+// Cipher encrypts small payloads into versioned envelopes with an AEAD. The
+// envelopes are those of the metav1 encrypted columns.
+type Cipher = aead.Cipher
+
+// NewCipher creates a Cipher encrypting with alg. It decrypts the envelopes
+// of both algorithms, so the algorithm can be changed later.
+func NewCipher(alg CipherAlgorithm, key []byte) (*Cipher, error) {
+	return aead.NewCipher(alg, key)
+}
+
+// BoxKeyPair is a X25519 key pair of NaCl box.
+type BoxKeyPair struct {
+	PublicKey  *[32]byte
+	PrivateKey *[32]byte
+}
+
+// GenerateBoxKeyPair returns a random X25519 key pair.
+func GenerateBoxKeyPair() (*BoxKeyPair, error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoxKeyPair{PublicKey: pub, PrivateKey: priv}, nil
+}
+
+// SealBox encrypts message for the recipient and authenticates it as sent by
+// the sender. The random nonce prefixes the box.
+func SealBox(message []byte, recipient *[32]byte, sender *BoxKeyPair) ([]byte, error) {
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	return box.Seal(nonce[:], message, &nonce, recipient, sender.PrivateKey), nil
+}
+
+// OpenBox decrypts a box sealed by SealBox, sender is the public key of the expected sender.
+func OpenBox(sealed []byte, sender *[32]byte, recipient *BoxKeyPair) ([]byte, error) {
+	if len(sealed) < 24+box.Overhead {
+		return nil, ErrInvalidCiphertext
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed)
+	message, ok := box.Open(nil, sealed[24:], &nonce, sender, recipient.PrivateKey)
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+
+	return message, nil
+}
+
+// SealAnonymousBox encrypts message for the recipient without identifying the sender.
+func SealAnonymousBox(message []byte, recipient *[32]byte) ([]byte, error) {
+	return box.SealAnonymous(nil, message, recipient, rand.Reader)
+}
+
+// OpenAnonymousBox decrypts a box sealed by SealAnonymousBox.
+func OpenAnonymousBox(sealed []byte, recipient *BoxKeyPair) ([]byte, error) {
+	message, ok := box.OpenAnonymous(nil, sealed, recipient.PublicKey, recipient.PrivateKey)
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+
+	return message, nil
+}
+
+// signatureBlockType is the PEM type of armored signatures.
+const signatureBlockType = "ED25519 SIGNATURE"
+
+// SignDetached returns the base64url encoded Ed25519 signature of message.
+func SignDetached(privateKey ed25519.PrivateKey, message []byte) (string, error) {
+	sig, err := signEd25519(privateKey, message)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyDetached verifies a signature returned by SignDetached.
+func VerifyDetached(publicKey ed25519.PublicKey, message []byte, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrSignatureMismatch
+	}
+
+	return verifyEd25519(publicKey, message, sig)
+}
+
+// SignArmored returns the Ed25519 signature of message as PEM block, to be
+// shipped next to a file.
+func SignArmored(privateKey ed25519.PrivateKey, message []byte) (string, error) {
+	sig, err := signEd25519(privateKey, message)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: signatureBlockType, Bytes: sig})), nil
+}
+
+// VerifyArmored verifies a signature returned by SignArmored.
+func VerifyArmored(publicKey ed25519.PublicKey, message []byte, armored string) error {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != signatureBlockType {
+		return ErrSignatureMismatch
+	}
+
+	return verifyEd25519(publicKey, message, block.Bytes)
+}
+
+func signEd25519(privateKey ed25519.PrivateKey, message []byte) ([]byte, error) {
+	// ed25519.Sign panics on a key of another size
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%w: ed25519 private key of %d bytes", ErrUnsupportedKeyType, len(privateKey))
+	}
+
+	return ed25519.Sign(privateKey, message), nil
+}
+
+func verifyEd25519(publicKey ed25519.PublicKey, message, sig []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: ed25519 public key of %d bytes", ErrUnsupportedKeyType, len(publicKey))
+	}
+	if !ed25519.Verify(publicKey, message, sig) {
+		return ErrSignatureMismatch
+	}
+
+	return nil
+}
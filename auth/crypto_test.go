@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestBox(t *testing.T) {
+	sender, err := GenerateBoxKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := GenerateBoxKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateBoxKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealBox([]byte("message"), recipient.PublicKey, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := OpenBox(sealed, sender.PublicKey, recipient)
+	if err != nil || string(message) != "message" {
+		t.Fatalf("OpenBox() = %q, %v", message, err)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name      string
+		sealed    []byte
+		sender    *[32]byte
+		recipient *BoxKeyPair
+		want      error
+	}{
+		{"other sender", sealed, other.PublicKey, recipient, ErrDecryptFailed},
+		{"other recipient", sealed, sender.PublicKey, other, ErrDecryptFailed},
+		{"tampered", tampered, sender.PublicKey, recipient, ErrDecryptFailed},
+		{"truncated", sealed[:30], sender.PublicKey, recipient, ErrInvalidCiphertext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenBox(tt.sealed, tt.sender, tt.recipient); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymousBox(t *testing.T) {
+	recipient, err := GenerateBoxKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateBoxKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealAnonymousBox([]byte("message"), recipient.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := OpenAnonymousBox(sealed, recipient)
+	if err != nil || string(message) != "message" {
+		t.Fatalf("OpenAnonymousBox() = %q, %v", message, err)
+	}
+	if _, err := OpenAnonymousBox(sealed, other); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("got %v, want %v", err, ErrDecryptFailed)
+	}
+	if _, err := OpenAnonymousBox(sealed[:10], recipient); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("truncated: got %v, want %v", err, ErrDecryptFailed)
+	}
+}
+
+func TestEd25519Signatures(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("message")
+
+	detached, err := SignDetached(privateKey, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := SignArmored(privateKey, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		verify func(publicKey ed25519.PublicKey, message []byte, signature string) error
+		sig    string
+	}{
+		{"detached", VerifyDetached, detached},
+		{"armored", VerifyArmored, armored},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.verify(publicKey, message, tt.sig); err != nil {
+				t.Errorf("verify: %v", err)
+			}
+			if err := tt.verify(publicKey, []byte("other"), tt.sig); !errors.Is(err, ErrSignatureMismatch) {
+				t.Errorf("other message: got %v, want %v", err, ErrSignatureMismatch)
+			}
+			if err := tt.verify(otherKey, message, tt.sig); !errors.Is(err, ErrSignatureMismatch) {
+				t.Errorf("other key: got %v, want %v", err, ErrSignatureMismatch)
+			}
+			if err := tt.verify(publicKey, message, "malformed"); !errors.Is(err, ErrSignatureMismatch) {
+				t.Errorf("malformed signature: got %v, want %v", err, ErrSignatureMismatch)
+			}
+			if err := tt.verify(publicKey[:16], message, tt.sig); !errors.Is(err, ErrUnsupportedKeyType) {
+				t.Errorf("short public key: got %v, want %v", err, ErrUnsupportedKeyType)
+			}
+		})
+	}
+
+	short := ed25519.PrivateKey(bytes.Repeat([]byte{1}, 32))
+	if _, err := SignDetached(short, message); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("SignDetached with a short key: got %v, want %v", err, ErrUnsupportedKeyType)
+	}
+	if _, err := SignArmored(nil, message); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("SignArmored without key: got %v, want %v", err, ErrUnsupportedKeyType)
+	}
+}
@@ -0,0 +1,430 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bxsec/gotool/util/net"
+)
+
+// Define the headers of a signed request.
+const (
+	HeaderDate          = "X-Date"
+	HeaderNonce         = "X-Nonce"
+	HeaderContentSHA256 = "X-Content-Sha256"
+
+	// SigningAlgorithm is the scheme of the Authorization header of a signed request.
+	SigningAlgorithm = "HMAC-SHA256"
+
+	// signingTimeFormat is the format of HeaderDate.
+	signingTimeFormat = "20060102T150405Z"
+)
+
+// Define the errors returned when a signed request is rejected.
+var (
+	ErrMissingSignature = errors.New("request is not signed")
+	ErrInvalidSignature = errors.New("request signature is invalid")
+	ErrRequestExpired   = errors.New("request timestamp is outside the allowed window")
+	ErrReplayedRequest  = errors.New("request nonce has been used")
+	ErrBodyHashMismatch = errors.New("request body does not match its hash")
+	ErrBodyTooLarge     = errors.New("request body is too large")
+)
+
+// DefaultSignedHeaders are the headers always covered by the signature.
+var DefaultSignedHeaders = []string{"host", strings.ToLower(HeaderDate), strings.ToLower(HeaderNonce),
+	strings.ToLower(HeaderContentSHA256)}
+
+// SignRequest signs req with the secretId/secretKey pair. The signature covers the
+// method, path, sorted query string, DefaultSignedHeaders, the extra headers and the body hash.
+func SignRequest(req *http.Request, secretID, secretKey string, headers ...string) error {
+	return signRequest(req, secretID, secretKey, time.Now(), headers)
+}
+
+func signRequest(req *http.Request, secretID, secretKey string, now time.Time, headers []string) error {
+	body, err := readBody(req, -1)
+	if err != nil {
+		return err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(HeaderDate, now.UTC().Format(signingTimeFormat))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderContentSHA256, hashHex(body))
+
+	signedHeaders := canonicalHeaderNames(headers)
+	signature := computeSignature(req, secretKey, signedHeaders)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		SigningAlgorithm, secretID, strings.Join(signedHeaders, ";"), signature))
+
+	return nil
+}
+
+// SigningTransport is a http.RoundTripper signing every request with SignRequest.
+type SigningTransport struct {
+	SecretID  string
+	SecretKey string
+
+	// Headers are the extra headers to sign.
+	Headers []string
+
+	// Base is the RoundTripper sending the signed requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+var _ http.RoundTripper = &SigningTransport{}
+
+// NewSigningTransport creates a SigningTransport sending the requests with base.
+func NewSigningTransport(secretID, secretKey string, base http.RoundTripper) *SigningTransport {
+	return &SigningTransport{SecretID: secretID, SecretKey: secretKey, Base: base}
+}
+
+// RoundTrip signs a copy of req and sends it.
+func (t *SigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	signed := req.Clone(req.Context())
+	if err := SignRequest(signed, t.SecretID, t.SecretKey, t.Headers...); err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(signed)
+}
+
+// NonceCache remembers the nonces of the accepted requests.
+type NonceCache interface {
+	// Add records nonce until expiresAt, it returns false if nonce is already recorded.
+	Add(nonce string, expiresAt time.Time) bool
+}
+
+// MemoryNonceCache is a NonceCache keeping the nonces in memory.
+type MemoryNonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	now    func() time.Time
+}
+
+var _ NonceCache = &MemoryNonceCache{}
+
+// NewMemoryNonceCache creates an empty MemoryNonceCache.
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{nonces: make(map[string]time.Time), now: time.Now}
+}
+
+// Add records nonce until expiresAt, it returns false if nonce is already recorded.
+func (c *MemoryNonceCache) Add(nonce string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if exp, ok := c.nonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+
+	// drop the expired nonces from time to time
+	if len(c.nonces)%1024 == 0 {
+		for n, exp := range c.nonces {
+			if !now.Before(exp) {
+				delete(c.nonces, n)
+			}
+		}
+	}
+	c.nonces[nonce] = expiresAt
+
+	return true
+}
+
+type secretIDContextKey struct{}
+
+// SecretIDFromContext returns the secretId of the signed request stored in ctx.
+func SecretIDFromContext(ctx context.Context) (string, bool) {
+	secretID, ok := ctx.Value(secretIDContextKey{}).(string)
+
+	return secretID, ok
+}
+
+// Default settings of a RequestVerifier.
+const (
+	DefaultTimeWindow  = 5 * time.Minute
+	DefaultMaxBodySize = 10 << 20
+)
+
+// RequestVerifier verifies the requests signed by SignRequest.
+type RequestVerifier struct {
+	secretFunc  SecretFunc
+	window      time.Duration
+	nonces      NonceCache
+	maxBodySize int64
+	logger      *log.Logger
+	now         func() time.Time
+}
+
+// RequestVerifierOption defines optional parameters for a RequestVerifier.
+type RequestVerifierOption func(*RequestVerifier)
+
+// WithTimeWindow sets how far the request timestamp may be off the server time.
+func WithTimeWindow(window time.Duration) RequestVerifierOption {
+	return func(v *RequestVerifier) {
+		v.window = window
+	}
+}
+
+// WithNonceCache sets the cache of the used nonces.
+func WithNonceCache(nonces NonceCache) RequestVerifierOption {
+	return func(v *RequestVerifier) {
+		v.nonces = nonces
+	}
+}
+
+// WithMaxBodySize sets the maximum size of a request body read to verify its hash.
+func WithMaxBodySize(size int64) RequestVerifierOption {
+	return func(v *RequestVerifier) {
+		v.maxBodySize = size
+	}
+}
+
+// WithRequestLogger sets the logger of the rejected requests.
+func WithRequestLogger(logger *log.Logger) RequestVerifierOption {
+	return func(v *RequestVerifier) {
+		v.logger = logger
+	}
+}
+
+// NewRequestVerifier creates a RequestVerifier looking up the secretKey of a request with secretFunc.
+func NewRequestVerifier(secretFunc SecretFunc, opts ...RequestVerifierOption) *RequestVerifier {
+	v := &RequestVerifier{
+		secretFunc:  secretFunc,
+		window:      DefaultTimeWindow,
+		nonces:      NewMemoryNonceCache(),
+		maxBodySize: DefaultMaxBodySize,
+		logger:      log.Default(),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+// Verify verifies the signature of r and returns its secretId. The body of r
+// is read and replaced, so it can be read again.
+func (v *RequestVerifier) Verify(r *http.Request) (string, error) {
+	secretID, signedHeaders, signature, err := parseAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	for _, name := range DefaultSignedHeaders {
+		if !containsString(signedHeaders, name) {
+			return "", fmt.Errorf("%w: header %s is not signed", ErrInvalidSignature, name)
+		}
+	}
+
+	date, err := time.Parse(signingTimeFormat, r.Header.Get(HeaderDate))
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid %s header", ErrInvalidSignature, HeaderDate)
+	}
+	now := v.now()
+	if date.Before(now.Add(-v.window)) || date.After(now.Add(v.window)) {
+		return "", ErrRequestExpired
+	}
+
+	secretKey, err := v.secretFunc(secretID)
+	if err != nil {
+		return "", err
+	}
+	expected := computeSignature(r, secretKey, signedHeaders)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", ErrInvalidSignature
+	}
+
+	body, err := readBody(r, v.maxBodySize)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(hashHex(body)), []byte(r.Header.Get(HeaderContentSHA256))) {
+		return "", ErrBodyHashMismatch
+	}
+
+	// the nonce only needs to be remembered while the timestamp is accepted
+	if !v.nonces.Add(secretID+":"+r.Header.Get(HeaderNonce), date.Add(v.window)) {
+		return "", ErrReplayedRequest
+	}
+
+	return secretID, nil
+}
+
+// Handler wraps next, next is only called for correctly signed requests and
+// can get the secretId with SecretIDFromContext.
+func (v *RequestVerifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretID, err := v.Verify(r)
+		if err != nil {
+			httpErr := PublicError(err)
+			// X-Forwarded-For and X-Real-IP are set by the client, do not log them as its address
+			v.logger.Printf("auth: reject signed %s %s from %s with %d: %v", r.Method, r.URL.Path,
+				r.RemoteAddr, httpErr.Code, err)
+			WriteError(w, httpErr)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), secretIDContextKey{}, secretID)))
+	})
+}
+
+// computeSignature returns the hex encoded signature of the canonical request.
+func computeSignature(r *http.Request, secretKey string, signedHeaders []string) string {
+	canonical := canonicalRequest(r, signedHeaders)
+	stringToSign := strings.Join([]string{
+		SigningAlgorithm,
+		r.Header.Get(HeaderDate),
+		r.Header.Get(HeaderNonce),
+		hashHex([]byte(canonical)),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(stringToSign))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalRequest builds the string covered by the signature.
+func canonicalRequest(r *http.Request, signedHeaders []string) string {
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		var value string
+		if name == "host" {
+			value = r.Host
+			if value == "" {
+				value = r.URL.Host
+			}
+		} else {
+			value = strings.Join(r.Header.Values(name), ",")
+		}
+		headers.WriteString(name)
+		headers.WriteByte(':')
+		headers.WriteString(strings.TrimSpace(value))
+		headers.WriteByte('\n')
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		path,
+		net.ConvertValues2String(r.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		r.Header.Get(HeaderContentSHA256),
+	}, "\n")
+}
+
+// canonicalHeaderNames returns the lower cased, sorted and deduplicated
+// DefaultSignedHeaders and extra headers.
+func canonicalHeaderNames(extra []string) []string {
+	seen := make(map[string]struct{})
+	names := make([]string, 0, len(DefaultSignedHeaders)+len(extra))
+	for _, name := range append(append([]string(nil), DefaultSignedHeaders...), extra...) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// parseAuthorization parses "HMAC-SHA256 Credential=id, SignedHeaders=a;b, Signature=hex".
+func parseAuthorization(header string) (secretID string, signedHeaders []string, signature string, err error) {
+	if !strings.HasPrefix(header, SigningAlgorithm+" ") {
+		return "", nil, "", ErrMissingSignature
+	}
+
+	for _, part := range strings.Split(strings.TrimPrefix(header, SigningAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return "", nil, "", fmt.Errorf("%w: malformed Authorization header", ErrInvalidSignature)
+		}
+		switch kv[0] {
+		case "Credential":
+			secretID = kv[1]
+		case "SignedHeaders":
+			signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	if secretID == "" || len(signedHeaders) == 0 || signature == "" {
+		return "", nil, "", fmt.Errorf("%w: malformed Authorization header", ErrInvalidSignature)
+	}
+
+	return secretID, signedHeaders, signature, nil
+}
+
+// readBody reads the body of r and replaces it with a copy, limit < 0 means no limit.
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	reader := io.Reader(r.Body)
+	if limit >= 0 {
+		reader = io.LimitReader(r.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestVerifier(t *testing.T) {
+	now := time.Now()
+	secretFunc := func(secretID string) (string, error) {
+		if secretID != "id" {
+			return "", ErrUnknownKid
+		}
+
+		return "key", nil
+	}
+	newRequest := func() *http.Request {
+		return httptest.NewRequest(http.MethodPost, "http://api.example.com/v1/users?b=2&a=1",
+			strings.NewReader(`{"name":"alice"}`))
+	}
+	sign := func(r *http.Request, secretID string, at time.Time) *http.Request {
+		if err := signRequest(r, secretID, "key", at, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		want    error
+	}{
+		{"signed", func() *http.Request { return sign(newRequest(), "id", now) }, nil},
+		{"clock skew within the window", func() *http.Request {
+			return sign(newRequest(), "id", now.Add(DefaultTimeWindow-time.Second))
+		}, nil},
+		{"not signed", newRequest, ErrMissingSignature},
+		{"too old", func() *http.Request {
+			return sign(newRequest(), "id", now.Add(-DefaultTimeWindow-time.Second))
+		}, ErrRequestExpired},
+		{"too far in the future", func() *http.Request {
+			return sign(newRequest(), "id", now.Add(DefaultTimeWindow+time.Second))
+		}, ErrRequestExpired},
+		{"unknown key id", func() *http.Request { return sign(newRequest(), "other", now) }, ErrUnknownKid},
+		{"tampered query", func() *http.Request {
+			r := sign(newRequest(), "id", now)
+			r.URL.RawQuery = "a=1&b=3"
+
+			return r
+		}, ErrInvalidSignature},
+		{"tampered body", func() *http.Request {
+			r := sign(newRequest(), "id", now)
+			r.Body = io.NopCloser(strings.NewReader(`{"name":"admin"}`))
+
+			return r
+		}, ErrBodyHashMismatch},
+		{"unsigned default header", func() *http.Request {
+			r := sign(newRequest(), "id", now)
+			r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), "host;", "", 1))
+
+			return r
+		}, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewRequestVerifier(secretFunc)
+			v.now = func() time.Time { return now }
+
+			r := tt.request()
+			secretID, err := v.Verify(r)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if secretID != "id" {
+				t.Errorf("got secretId %q", secretID)
+			}
+			if body, _ := io.ReadAll(r.Body); string(body) != `{"name":"alice"}` {
+				t.Errorf("body %q can not be read again", body)
+			}
+		})
+	}
+}
+
+func TestRequestVerifierReplay(t *testing.T) {
+	v := NewRequestVerifier(func(string) (string, error) { return "key", nil })
+
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/v1/users", nil)
+	if err := SignRequest(r, "id", "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(r); !errors.Is(err, ErrReplayedRequest) {
+		t.Errorf("got %v, want %v", err, ErrReplayedRequest)
+	}
+}
+
+func TestRequestVerifierBodyTooLarge(t *testing.T) {
+	v := NewRequestVerifier(func(string) (string, error) { return "key", nil }, WithMaxBodySize(4))
+
+	r := httptest.NewRequest(http.MethodPost, "http://api.example.com/v1/users", strings.NewReader("too large"))
+	if err := SignRequest(r, "id", "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(r); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("got %v, want %v", err, ErrBodyTooLarge)
+	}
+}
+
+func TestSigningTransport(t *testing.T) {
+	var logs strings.Builder
+	v := NewRequestVerifier(func(string) (string, error) { return "key", nil },
+		WithRequestLogger(log.New(&logs, "", 0)))
+	server := httptest.NewServer(v.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretID, _ := SecretIDFromContext(r.Context())
+		_, _ = io.WriteString(w, secretID)
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewSigningTransport("id", "key", nil)}
+	resp, err := client.Post(server.URL+"/v1/users", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "id" {
+		t.Errorf("got %d %q, want 200 id", resp.StatusCode, body)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned request: got %d, want 401", resp.StatusCode)
+	}
+	if strings.Contains(logs.String(), "198.51.100.1") || !strings.Contains(logs.String(), "127.0.0.1:") {
+		t.Errorf("got log %q, want the remote address only", logs.String())
+	}
+}
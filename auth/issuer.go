@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultTTL is the default lifetime of the tokens issued by an Issuer.
+const DefaultTTL = time.Minute
+
+// Issuer issues jwt tokens signed with the signing key of a SigningKeySet.
+type Issuer struct {
+	keys     SigningKeySet
+	issuer   string
+	audience string
+	subject  string
+	ttl      time.Duration
+	claims   map[string]interface{}
+	method   jwt.SigningMethod
+	jtiFunc  func() (string, error)
+	now      func() time.Time
+}
+
+// IssuerOption defines optional parameters for an Issuer.
+type IssuerOption func(*Issuer)
+
+// WithTTL sets the lifetime of the issued tokens.
+func WithTTL(ttl time.Duration) IssuerOption {
+	return func(i *Issuer) {
+		i.ttl = ttl
+	}
+}
+
+// WithSubject sets the sub claim of the issued tokens.
+func WithSubject(sub string) IssuerOption {
+	return func(i *Issuer) {
+		i.subject = sub
+	}
+}
+
+// WithClaims adds custom claims to the issued tokens. Registered claims
+// such as exp or iss can not be overwritten by custom claims.
+func WithClaims(claims map[string]interface{}) IssuerOption {
+	return func(i *Issuer) {
+		merged := make(map[string]interface{}, len(i.claims)+len(claims))
+		for k, v := range i.claims {
+			merged[k] = v
+		}
+		for k, v := range claims {
+			merged[k] = v
+		}
+		i.claims = merged
+	}
+}
+
+// WithJTI sets the function generating the jti claim. A nil function
+// disables the jti claim.
+func WithJTI(jtiFunc func() (string, error)) IssuerOption {
+	return func(i *Issuer) {
+		i.jtiFunc = jtiFunc
+	}
+}
+
+// WithSigningMethod sets the algorithm used to sign the tokens, it
+// overwrites the algorithm of the signing key.
+func WithSigningMethod(method jwt.SigningMethod) IssuerOption {
+	return func(i *Issuer) {
+		i.method = method
+	}
+}
+
+// WithTimeFunc sets the function used to get the issuing time.
+func WithTimeFunc(now func() time.Time) IssuerOption {
+	return func(i *Issuer) {
+		i.now = now
+	}
+}
+
+// NewIssuer creates an Issuer based on secretId, secretKey, iss and aud.
+func NewIssuer(secretId, secretKey, iss, aud string, opts ...IssuerOption) *Issuer {
+	return NewKeySetIssuer(NewStaticKeySet(NewHMACKey(secretId, secretKey)), iss, aud, opts...)
+}
+
+// NewKeySetIssuer creates an Issuer signing with the signing key of keys.
+func NewKeySetIssuer(keys SigningKeySet, iss, aud string, opts ...IssuerOption) *Issuer {
+	i := &Issuer{
+		keys:     keys,
+		issuer:   iss,
+		audience: aud,
+		ttl:      DefaultTTL,
+		jtiFunc:  NewJTI,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Issue issues a jwt token, opts overwrite the options of the Issuer for this token only.
+func (i *Issuer) Issue(opts ...IssuerOption) (string, error) {
+	issuer := *i
+	for _, opt := range opts {
+		opt(&issuer)
+	}
+
+	return issuer.sign()
+}
+
+func (i *Issuer) sign() (string, error) {
+	key, err := i.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	method := key.Method
+	if i.method != nil {
+		method = i.method
+	}
+	if key.PrivateKey == nil || method == nil || !key.Allows(method.Alg()) {
+		return "", fmt.Errorf("%w: key %q can not sign %v", ErrUnexpectedSigningMethod, key.ID, method)
+	}
+
+	now := i.now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.issuer,
+			Subject:   i.subject,
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Extra: i.claims,
+	}
+	if i.audience != "" {
+		claims.Audience = jwt.ClaimStrings{i.audience}
+	}
+	if i.jtiFunc != nil {
+		jti, err := i.jtiFunc()
+		if err != nil {
+			return "", fmt.Errorf("generate jti: %w", err)
+		}
+		claims.ID = jti
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+
+	// Sign the token with the specified key.
+	return token.SignedString(key.PrivateKey)
+}
+
+// NewJTI generates a random jti.
+func NewJTI() (string, error) {
+	return randomString(16)
+}
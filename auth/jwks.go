@@ -0,0 +1,412 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/bxsec/gotool/json"
+)
+
+// Define the errors of JWKS documents.
+var (
+	ErrUnpublishableKey  = errors.New("key can not be published")
+	ErrKeySetUnavailable = errors.New("jwks document can not be fetched")
+)
+
+// JWK is a public key in JSON Web Key format, see RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA public key.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// ECDSA or Ed25519 public key.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyLister is implemented by key sets which can enumerate their keys.
+type KeyLister interface {
+	Keys() []*Key
+}
+
+// NewJWK converts the public half of key into a JWK. HMAC keys are rejected
+// since their secret would be published.
+func NewJWK(key *Key) (JWK, error) {
+	jwk := JWK{Kid: key.ID, Use: "sig"}
+	if key.Method != nil {
+		jwk.Alg = key.Method.Alg()
+	}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBigInt(pub.N, 0)
+		jwk.E = encodeBigInt(big.NewInt(int64(pub.E)), 0)
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeBigInt(pub.X, size)
+		jwk.Y = encodeBigInt(pub.Y, size)
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("%w: %T", ErrUnpublishableKey, key.PublicKey)
+	}
+
+	return jwk, nil
+}
+
+// Key converts the JWK into a verification key.
+func (jwk JWK) Key() (*Key, error) {
+	var pub interface{}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		pub = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		curve, err := ellipticCurve(jwk.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid jwk %q: point is not on curve %s", jwk.Kid, jwk.Crv)
+		}
+		pub = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: OKP curve %s", ErrUnsupportedKeyType, jwk.Crv)
+		}
+		pub = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedKeyType, jwk.Kty)
+	}
+
+	key, err := NewKey(jwk.Kid, pub)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.Alg != "" {
+		method := jwt.GetSigningMethod(jwk.Alg)
+		if method == nil || !key.Allows(jwk.Alg) {
+			return nil, fmt.Errorf("%w: alg %s for kty %s", ErrUnexpectedSigningMethod, jwk.Alg, jwk.Kty)
+		}
+		key.Method = method
+	}
+
+	return key, nil
+}
+
+// NewJWKS converts the publishable keys into a JWKS document, HMAC keys are skipped.
+func NewJWKS(keys []*Key) JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+type jwksHandler struct {
+	keys   KeyLister
+	maxAge time.Duration
+}
+
+// NewJWKSHandler returns a http.Handler publishing the public keys of keys as JWKS document.
+// The keys are listed on every request, so rotated keys are published immediately.
+func NewJWKSHandler(keys KeyLister, maxAge time.Duration) http.Handler {
+	return &jwksHandler{keys: keys, maxAge: maxAge}
+}
+
+func (h *jwksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	data, err := json.Marshal(NewJWKS(h.keys.Keys()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if h.maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.maxAge.Seconds())))
+	}
+	_, _ = w.Write(data)
+}
+
+// Default settings of a RemoteKeySet.
+const (
+	DefaultRefreshInterval    = time.Hour
+	DefaultMinRefetchInterval = time.Minute
+)
+
+// maxJWKSSize limits the size of a fetched JWKS document.
+const maxJWKSSize = 1 << 20
+
+// RemoteKeySet is a KeySet backed by a JWKS document fetched from a url.
+// The document is refreshed periodically and refetched, at most once every
+// min refetch interval, when an unknown kid is seen. Only one fetch runs at
+// a time, the lookups of known keys never wait for it.
+type RemoteKeySet struct {
+	url                string
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefetchInterval time.Duration
+	now                func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*Key
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	inflight    *fetchCall
+}
+
+// fetchCall is a fetch of the JWKS document in progress, done is closed
+// once it completes.
+type fetchCall struct {
+	done chan struct{}
+	err  error
+}
+
+var _ KeySet = &RemoteKeySet{}
+
+// RemoteKeySetOption defines optional parameters for a RemoteKeySet.
+type RemoteKeySetOption func(*RemoteKeySet)
+
+// WithHTTPClient sets the http client used to fetch the JWKS document.
+func WithHTTPClient(client *http.Client) RemoteKeySetOption {
+	return func(s *RemoteKeySet) {
+		s.client = client
+	}
+}
+
+// WithRefreshInterval sets how long a fetched JWKS document is used before it is refreshed.
+func WithRefreshInterval(interval time.Duration) RemoteKeySetOption {
+	return func(s *RemoteKeySet) {
+		s.refreshInterval = interval
+	}
+}
+
+// WithMinRefetchInterval sets the minimum interval between two fetches.
+func WithMinRefetchInterval(interval time.Duration) RemoteKeySetOption {
+	return func(s *RemoteKeySet) {
+		s.minRefetchInterval = interval
+	}
+}
+
+// NewRemoteKeySet creates a RemoteKeySet fetching the JWKS document from url.
+func NewRemoteKeySet(url string, opts ...RemoteKeySetOption) *RemoteKeySet {
+	s := &RemoteKeySet{
+		url:                url,
+		client:             &http.Client{Timeout: 10 * time.Second},
+		refreshInterval:    DefaultRefreshInterval,
+		minRefetchInterval: DefaultMinRefetchInterval,
+		now:                time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// LookupKey returns the key for kid. A stale key is returned at once while
+// the document is refreshed in the background, an unknown kid waits for
+// the document to be refetched.
+func (s *RemoteKeySet) LookupKey(kid string) (*Key, error) {
+	s.mu.Lock()
+	now := s.now()
+	key, ok := s.keys[kid]
+	if ok && now.Sub(s.fetchedAt) < s.refreshInterval {
+		s.mu.Unlock()
+
+		return key, nil
+	}
+
+	var call *fetchCall
+	if s.inflight != nil || now.Sub(s.attemptedAt) >= s.minRefetchInterval {
+		call = s.fetch(now)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if call == nil {
+		return nil, ErrUnknownKid
+	}
+
+	<-call.done
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	s.mu.Lock()
+	key, ok = s.keys[kid]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownKid
+	}
+
+	return key, nil
+}
+
+// Refresh fetches the JWKS document now, or waits for the fetch in progress.
+func (s *RemoteKeySet) Refresh() error {
+	s.mu.Lock()
+	call := s.fetch(s.now())
+	s.mu.Unlock()
+
+	<-call.done
+
+	return call.err
+}
+
+// fetch starts fetching the JWKS document unless a fetch is in progress,
+// s.mu must be held.
+func (s *RemoteKeySet) fetch(now time.Time) *fetchCall {
+	if s.inflight != nil {
+		return s.inflight
+	}
+
+	s.attemptedAt = now
+	call := &fetchCall{done: make(chan struct{})}
+	s.inflight = call
+
+	go func() {
+		keys, err := s.fetchKeys()
+
+		s.mu.Lock()
+		if err == nil {
+			s.keys = keys
+			s.fetchedAt = now
+		}
+		s.inflight = nil
+		s.mu.Unlock()
+
+		call.err = err
+		close(call.done)
+	}()
+
+	return call
+}
+
+func (s *RemoteKeySet) fetchKeys() (map[string]*Key, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeySetUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %s", ErrKeySetUnavailable, resp.Status)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("%w: decode: %v", ErrKeySetUnavailable, err)
+	}
+
+	keys := make(map[string]*Key, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.Key()
+		if err != nil {
+			// skip the keys we do not understand
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	return keys, nil
+}
+
+func encodeBigInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		b = padded
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func ellipticCurve(crv string) (elliptic.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("%w: EC curve %s", ErrUnsupportedKeyType, crv)
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxsec/gotool/json"
+)
+
+func TestJWKSRoundTrip(t *testing.T) {
+	keys := newTestKeys(t)
+
+	data, err := json.Marshal(NewJWKS(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		t.Fatal(err)
+	}
+	// the HMAC key is not published
+	if len(jwks.Keys) != len(keys)-1 {
+		t.Fatalf("got %d keys, want %d", len(jwks.Keys), len(keys)-1)
+	}
+
+	published := make(map[string]*Key)
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		published[key.ID] = key
+	}
+	for _, key := range keys[1:] {
+		got, ok := published[key.ID]
+		if !ok {
+			t.Fatalf("key %q is not published", key.ID)
+		}
+		if !reflect.DeepEqual(got.PublicKey, key.PublicKey) || got.Method != key.Method || got.PrivateKey != nil {
+			t.Errorf("key %q does not round trip: got %+v, want %+v", key.ID, got, key.Public())
+		}
+	}
+}
+
+func TestJWKAlgMismatch(t *testing.T) {
+	jwk, err := NewJWK(newTestKeys(t)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.Alg = "HS256"
+	if _, err := jwk.Key(); !errors.Is(err, ErrUnexpectedSigningMethod) {
+		t.Errorf("got %v, want %v", err, ErrUnexpectedSigningMethod)
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	keys := newTestKeys(t)
+	static := NewStaticKeySet(keys[1])
+
+	var fetches int32
+	handler := NewJWKSHandler(static, time.Minute)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	remote := NewRemoteKeySet(server.URL)
+	token, err := NewKeySetIssuer(static, "iss", "aud").Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWithKeySet(token, remote, WithIssuer("iss"), WithAudience("aud")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.LookupKey("unknown"); !errors.Is(err, ErrUnknownKid) {
+		t.Errorf("got %v, want %v", err, ErrUnknownKid)
+	}
+	// the unknown kid is not refetched within the min refetch interval
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("got %d fetches, want 1", n)
+	}
+}
+
+func TestRemoteKeySetFetchDoesNotBlock(t *testing.T) {
+	key := newTestKeys(t)[1]
+	document, err := json.Marshal(NewJWKS([]*Key{key}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		_, _ = w.Write(document)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	remote := NewRemoteKeySet(server.URL, WithMinRefetchInterval(0))
+	if err := remote.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unknown kid blocks on the second fetch
+	go func() { _, _ = remote.LookupKey("unknown") }()
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := remote.LookupKey(key.ID)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup of a known key waits for the fetch")
+	}
+}
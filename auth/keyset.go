@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Define the errors returned by key sets.
+var (
+	ErrNoSigningKey       = errors.New("no signing key available")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
+
+// Key is a signing or verification key identified by the `kid` header of a token.
+type Key struct {
+	// ID is the kid of the key.
+	ID string
+
+	// Method is the algorithm used to sign tokens with this key.
+	Method jwt.SigningMethod
+
+	// PrivateKey is the key used to sign tokens, it is one of []byte,
+	// *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+	// Nil for verification only keys.
+	PrivateKey interface{}
+
+	// PublicKey is the key used to verify tokens, it is one of []byte,
+	// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+	PublicKey interface{}
+}
+
+// KeySet looks up the keys used to verify tokens by kid.
+type KeySet interface {
+	// LookupKey returns the key for kid, or ErrUnknownKid if there is none.
+	LookupKey(kid string) (*Key, error)
+}
+
+// SigningKeySet is a KeySet which also provides the key to sign tokens with.
+type SigningKeySet interface {
+	KeySet
+
+	// SigningKey returns the key used to sign new tokens.
+	SigningKey() (*Key, error)
+}
+
+// NewHMACKey creates a HS256 key from a secretId/secretKey pair.
+func NewHMACKey(secretId, secretKey string) *Key {
+	return &Key{
+		ID:         secretId,
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: []byte(secretKey),
+		PublicKey:  []byte(secretKey),
+	}
+}
+
+// NewKey creates a key from a private or public key, the signing method is
+// derived from the key type.
+func NewKey(kid string, key interface{}) (*Key, error) {
+	k := &Key{ID: kid}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k.PrivateKey, k.PublicKey = key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.PublicKey = key
+	case *ecdsa.PrivateKey:
+		k.PrivateKey, k.PublicKey = key, &key.PublicKey
+	case *ecdsa.PublicKey:
+		k.PublicKey = key
+	case ed25519.PrivateKey:
+		k.PrivateKey, k.PublicKey = key, key.Public()
+	case ed25519.PublicKey:
+		k.PublicKey = key
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, key)
+	}
+
+	method, err := defaultMethod(k.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	k.Method = method
+
+	return k, nil
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded RSA, ECDSA or Ed25519 private key.
+func ParsePrivateKeyPEM(kid string, data []byte) (*Key, error) {
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return NewKey(kid, key)
+	}
+	if key, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		return NewKey(kid, key)
+	}
+	key, err := jwt.ParseEdPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a RSA, ECDSA or Ed25519 private key", ErrUnsupportedKeyType)
+	}
+
+	return NewKey(kid, key)
+}
+
+// ParsePublicKeyPEM parses a PEM encoded RSA, ECDSA or Ed25519 public key.
+func ParsePublicKeyPEM(kid string, data []byte) (*Key, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return NewKey(kid, key)
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return NewKey(kid, key)
+	}
+	key, err := jwt.ParseEdPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a RSA, ECDSA or Ed25519 public key", ErrUnsupportedKeyType)
+	}
+
+	return NewKey(kid, key)
+}
+
+// LoadPrivateKeyFile loads a PEM encoded private key from file.
+func LoadPrivateKeyFile(kid, file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrivateKeyPEM(kid, data)
+}
+
+// LoadPublicKeyFile loads a PEM encoded public key from file.
+func LoadPublicKeyFile(kid, file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePublicKeyPEM(kid, data)
+}
+
+// Public returns a copy of the key without its private half.
+func (k *Key) Public() *Key {
+	return &Key{
+		ID:        k.ID,
+		Method:    k.Method,
+		PublicKey: k.PublicKey,
+	}
+}
+
+// Allows reports whether tokens signed with alg may be verified with this key.
+// It prevents a public key to be used as a HMAC secret.
+func (k *Key) Allows(alg string) bool {
+	if k.Method != nil && k.Method.Alg() == alg {
+		return true
+	}
+
+	switch k.PublicKey.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		// the curve determines the algorithm
+		return false
+	case ed25519.PublicKey:
+		return alg == jwt.SigningMethodEdDSA.Alg()
+	default:
+		return false
+	}
+}
+
+func defaultMethod(publicKey interface{}) (jwt.SigningMethod, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return jwt.SigningMethodES256, nil
+		case 384:
+			return jwt.SigningMethodES384, nil
+		case 521:
+			return jwt.SigningMethodES512, nil
+		default:
+			return nil, fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedKeyType, key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, publicKey)
+	}
+}
+
+// StaticKeySet is a SigningKeySet holding a fixed list of keys.
+type StaticKeySet struct {
+	keys    map[string]*Key
+	signing *Key
+}
+
+var _ SigningKeySet = &StaticKeySet{}
+
+// NewStaticKeySet creates a StaticKeySet, the first key having a private
+// half is used to sign tokens.
+func NewStaticKeySet(keys ...*Key) *StaticKeySet {
+	s := &StaticKeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+		if s.signing == nil && key.PrivateKey != nil {
+			s.signing = key
+		}
+	}
+
+	return s
+}
+
+// LookupKey returns the key for kid.
+func (s *StaticKeySet) LookupKey(kid string) (*Key, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKid
+	}
+
+	return key, nil
+}
+
+// SigningKey returns the key used to sign new tokens.
+func (s *StaticKeySet) SigningKey() (*Key, error) {
+	if s.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return s.signing, nil
+}
+
+// Keys returns all keys of the set.
+func (s *StaticKeySet) Keys() []*Key {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys
+}
+
+// LookupKey makes a SecretFunc usable as a KeySet of HMAC keys.
+func (f SecretFunc) LookupKey(kid string) (*Key, error) {
+	secretKey, err := f(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHMACKey(kid, secretKey), nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func newTestKeys(t *testing.T) []*Key {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []*Key{NewHMACKey("hmac", "secret-key")}
+	for i, priv := range []interface{}{rsaKey, ecKey, edKey} {
+		key, err := NewKey([]string{"rsa", "ec", "ed"}[i], priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func TestIssueVerify(t *testing.T) {
+	for _, key := range newTestKeys(t) {
+		t.Run(key.ID, func(t *testing.T) {
+			keys := NewStaticKeySet(key)
+			token, err := NewKeySetIssuer(keys, "iss", "aud", WithSubject("sub")).Issue()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ParseWithKeySet(token, NewStaticKeySet(key.Public()), WithIssuer("iss"), WithAudience("aud"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "sub" || claims.KeyID != key.ID || claims.ID == "" {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+
+			if _, err := ParseWithKeySet(token, keys, WithAudience("other")); !errors.Is(err, ErrInvalidAudience) {
+				t.Errorf("verify with another audience: got %v, want %v", err, ErrInvalidAudience)
+			}
+			if _, err := ParseWithKeySet(token, keys, WithIssuer("other")); !errors.Is(err, ErrInvalidIssuer) {
+				t.Errorf("verify with another issuer: got %v, want %v", err, ErrInvalidIssuer)
+			}
+		})
+	}
+}
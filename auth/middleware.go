@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bxsec/gotool/json"
+	"github.com/bxsec/gotool/util/net"
+)
+
+// ErrMissingToken is returned when no token is found in the request.
+var ErrMissingToken = errors.New("missing token")
+
+// TokenExtractor extracts a token from the request, it returns an empty string if there is none.
+type TokenExtractor func(r *http.Request) string
+
+// FromAuthHeader extracts a bearer token from the Authorization header.
+func FromAuthHeader(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	return ""
+}
+
+// FromCookie returns a TokenExtractor extracting the token from the cookie name.
+func FromCookie(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+
+		return cookie.Value
+	}
+}
+
+// FromQuery returns a TokenExtractor extracting the token from the query parameter name.
+func FromQuery(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// FirstOf returns a TokenExtractor returning the first token found by extractors.
+func FirstOf(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) string {
+		for _, extractor := range extractors {
+			if token := extractor(r); token != "" {
+				return token
+			}
+		}
+
+		return ""
+	}
+}
+
+type claimsContextKey struct{}
+
+// NewContext returns a new Context that carries claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// FromContext returns the claims stored in ctx, if any.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+
+	return claims, ok
+}
+
+// SubjectFromContext returns the sub claim stored in ctx.
+func SubjectFromContext(ctx context.Context) string {
+	if claims, ok := FromContext(ctx); ok {
+		return claims.Subject
+	}
+
+	return ""
+}
+
+// ClaimFromContext returns the custom claim name stored in ctx.
+func ClaimFromContext(ctx context.Context, name string) (interface{}, bool) {
+	claims, ok := FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	v, ok := claims.Extra[name]
+
+	return v, ok
+}
+
+// ErrorResponse is the body written when a request is rejected.
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Middleware authenticates http requests with the tokens they carry.
+type Middleware struct {
+	verifier       *Verifier
+	extractor      TokenExtractor
+	authorizeFunc  func(r *http.Request, claims *Claims) error
+	logger         *log.Logger
+	trustedProxies net.TrustedProxies
+}
+
+// MiddlewareOption defines optional parameters for a Middleware.
+type MiddlewareOption func(*Middleware)
+
+// WithTokenExtractor sets how the token is extracted from the request,
+// the default is the bearer token of the Authorization header.
+func WithTokenExtractor(extractor TokenExtractor) MiddlewareOption {
+	return func(m *Middleware) {
+		m.extractor = extractor
+	}
+}
+
+// WithAuthorizeFunc sets a function checking the claims of an authenticated
+// request, the request is rejected with 403 if it returns an error.
+func WithAuthorizeFunc(fn func(r *http.Request, claims *Claims) error) MiddlewareOption {
+	return func(m *Middleware) {
+		m.authorizeFunc = fn
+	}
+}
+
+// WithLogger sets the logger of the rejected requests.
+func WithLogger(logger *log.Logger) MiddlewareOption {
+	return func(m *Middleware) {
+		m.logger = logger
+	}
+}
+
+// WithTrustedProxies sets the reverse proxies whose X-Forwarded-For header is
+// trusted for the client IP of the logged rejected requests.
+func WithTrustedProxies(proxies net.TrustedProxies) MiddlewareOption {
+	return func(m *Middleware) {
+		m.trustedProxies = proxies
+	}
+}
+
+// NewMiddleware creates a Middleware verifying the tokens with verifier.
+func NewMiddleware(verifier *Verifier, opts ...MiddlewareOption) *Middleware {
+	m := &Middleware{
+		verifier:  verifier,
+		extractor: FromAuthHeader,
+		logger:    log.Default(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Handler wraps next, next is only called for authenticated requests and
+// can get the claims with FromContext.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := m.extractor(r)
+		if token == "" {
+			m.reject(w, r, PublicError(ErrMissingToken))
+
+			return
+		}
+
+		claims, err := m.verifier.VerifyContext(r.Context(), token)
+		if err != nil {
+			m.reject(w, r, PublicError(err))
+
+			return
+		}
+
+		if m.authorizeFunc != nil {
+			if err := m.authorizeFunc(r, claims); err != nil {
+				m.reject(w, r, &HTTPError{Code: http.StatusForbidden, Message: "permission denied", Err: err})
+
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+func (m *Middleware) reject(w http.ResponseWriter, r *http.Request, err *HTTPError) {
+	m.logger.Printf("auth: reject %s %s from %s with %d: %v", r.Method, r.URL.Path, m.trustedProxies.ClientIP(r),
+		err.Code, err.Err)
+
+	if err.Code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	WriteError(w, err)
+}
+
+// HTTPError is an error with the status code and the message written to the
+// client, Err holds the details which are only logged.
+type HTTPError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// publicErrors maps the errors of authentication to their status code and
+// to a fixed message, so kids, expected claims or internal urls do not leak.
+var publicErrors = []struct {
+	err     error
+	code    int
+	message string
+}{
+	{ErrMissingToken, http.StatusUnauthorized, "missing token"},
+	{ErrTokenExpired, http.StatusUnauthorized, "token is expired"},
+	{ErrTokenNotValidYet, http.StatusUnauthorized, "token is not valid yet"},
+	{ErrTokenUsedBeforeIssued, http.StatusUnauthorized, "token is not valid yet"},
+	{ErrTokenRevoked, http.StatusUnauthorized, "token is revoked"},
+	{ErrTokenMalformed, http.StatusUnauthorized, "invalid token"},
+	{ErrSignatureInvalid, http.StatusUnauthorized, "invalid token"},
+	{ErrUnexpectedSigningMethod, http.StatusUnauthorized, "invalid token"},
+	{ErrMissingKid, http.StatusUnauthorized, "invalid token"},
+	{ErrUnknownKid, http.StatusUnauthorized, "invalid token"},
+	{ErrInvalidIssuer, http.StatusUnauthorized, "invalid token"},
+	{ErrInvalidAudience, http.StatusUnauthorized, "invalid token"},
+	{ErrMissingExpiry, http.StatusUnauthorized, "invalid token"},
+	{ErrSecretNotFound, http.StatusUnauthorized, "invalid credentials"},
+	{ErrSecretExpired, http.StatusUnauthorized, "invalid credentials"},
+	{ErrSecretDisabled, http.StatusUnauthorized, "invalid credentials"},
+	{ErrSecretMismatch, http.StatusUnauthorized, "invalid credentials"},
+	{ErrMissingSignature, http.StatusUnauthorized, "request is not signed"},
+	{ErrInvalidSignature, http.StatusUnauthorized, "invalid signature"},
+	{ErrBodyHashMismatch, http.StatusUnauthorized, "invalid signature"},
+	{ErrRequestExpired, http.StatusUnauthorized, "request is expired"},
+	{ErrReplayedRequest, http.StatusUnauthorized, "request has already been used"},
+	{ErrBodyTooLarge, http.StatusRequestEntityTooLarge, "request body is too large"},
+	{ErrKeySetUnavailable, http.StatusServiceUnavailable, "authentication is temporarily unavailable"},
+}
+
+// PublicError converts an authentication error into a HTTPError. The
+// unknown errors, such as database errors of a Revoker or a SecretFunc,
+// are internal server errors.
+func PublicError(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	for _, e := range publicErrors {
+		if errors.Is(err, e.err) {
+			return &HTTPError{Code: e.code, Message: e.message, Err: err}
+		}
+	}
+
+	return &HTTPError{Code: http.StatusInternalServerError, Message: http.StatusText(http.StatusInternalServerError), Err: err}
+}
+
+// WriteError writes err as ErrorResponse with the status code and the
+// public message of PublicError.
+func WriteError(w http.ResponseWriter, err error) {
+	httpErr := PublicError(err)
+	data, _ := json.Marshal(ErrorResponse{Code: httpErr.Code, Message: httpErr.Message})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpErr.Code)
+	_, _ = w.Write(data)
+}
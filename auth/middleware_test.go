@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingRevoker is a Revoker whose backend is down.
+type failingRevoker struct {
+	Revoker
+}
+
+func (failingRevoker) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	return false, errors.New("dial tcp 10.0.0.1:3306: connection refused")
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	keys := NewStaticKeySet(NewHMACKey("internal-kid", "key"))
+	token, err := NewKeySetIssuer(keys, "internal-iss", "aud").Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := NewRemoteKeySet("http://127.0.0.1:1/internal/jwks")
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		code     int
+		message  string
+	}{
+		{"ok", NewKeySetVerifier(keys), token, http.StatusOK, ""},
+		{"missing token", NewKeySetVerifier(keys), "", http.StatusUnauthorized, "missing token"},
+		{"wrong issuer", NewKeySetVerifier(keys, WithIssuer("other")), token, http.StatusUnauthorized, "invalid token"},
+		{"unknown kid", NewKeySetVerifier(NewStaticKeySet()), token, http.StatusUnauthorized, "invalid token"},
+		{"revoker error", NewKeySetVerifier(keys, WithRevoker(failingRevoker{})), token, http.StatusInternalServerError,
+			"Internal Server Error"},
+		{"jwks unavailable", NewKeySetVerifier(unreachable), token, http.StatusServiceUnavailable,
+			"authentication is temporarily unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMiddleware(tt.verifier, WithLogger(log.New(io.Discard, "", 0)))
+			handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("got status %d, want %d", w.Code, tt.code)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, tt.message) {
+				t.Errorf("got body %s, want message %q", body, tt.message)
+			}
+			for _, secret := range []string{"internal", "10.0.0.1"} {
+				if strings.Contains(body, secret) {
+					t.Errorf("body %s leaks %q", body, secret)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPErrorWithoutErr(t *testing.T) {
+	err := &HTTPError{Code: http.StatusForbidden, Message: "permission denied"}
+	if err.Error() != "permission denied" {
+		t.Errorf("got %q", err.Error())
+	}
+}
+
+func TestMiddlewareLogsPeerAddr(t *testing.T) {
+	var logs strings.Builder
+	m := NewMiddleware(NewKeySetVerifier(NewStaticKeySet()), WithLogger(log.New(&logs, "", 0)))
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !strings.Contains(logs.String(), "192.0.2.1") || strings.Contains(logs.String(), "198.51.100.1") {
+		t.Errorf("got log %q, want the peer address only", logs.String())
+	}
+}
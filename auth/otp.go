@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define the errors returned when a one-time password is rejected.
+var (
+	ErrInvalidOTP          = errors.New("invalid one-time password")
+	ErrOTPReplayed         = errors.New("one-time password has already been used")
+	ErrInvalidOTPSecret    = errors.New("invalid one-time password secret")
+	ErrInvalidOTPPeriod    = errors.New("invalid one-time password period")
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+)
+
+// OTPAlgorithm is the HMAC hash function of HOTP and TOTP.
+type OTPAlgorithm string
+
+// Define the OTP algorithms, most authenticator apps only support SHA1.
+const (
+	OTPAlgorithmSHA1   OTPAlgorithm = "SHA1"
+	OTPAlgorithmSHA256 OTPAlgorithm = "SHA256"
+	OTPAlgorithmSHA512 OTPAlgorithm = "SHA512"
+)
+
+func (a OTPAlgorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case OTPAlgorithmSHA1, "":
+		return sha1.New, nil
+	case OTPAlgorithmSHA256:
+		return sha256.New, nil
+	case OTPAlgorithmSHA512:
+		return sha512.New, nil
+	}
+
+	return nil, fmt.Errorf("unsupported otp algorithm %q", string(a))
+}
+
+// Define the default OTP settings.
+const (
+	DefaultOTPDigits     = 6
+	DefaultOTPPeriod     = 30 * time.Second
+	DefaultOTPSecretSize = 20
+)
+
+var otpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateOTPSecret returns a random base32 encoded secret of size bytes,
+// DefaultOTPSecretSize if size <= 0.
+func GenerateOTPSecret(size int) (string, error) {
+	if size <= 0 {
+		size = DefaultOTPSecretSize
+	}
+
+	b, err := randomBytes(size)
+	if err != nil {
+		return "", err
+	}
+
+	return otpEncoding.EncodeToString(b), nil
+}
+
+func decodeOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := otpEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidOTPSecret
+	}
+
+	return key, nil
+}
+
+// HOTP generates RFC 4226 one-time passwords.
+type HOTP struct {
+	// Secret is the base32 encoded shared secret.
+	Secret string
+
+	// Digits is the length of the codes, DefaultOTPDigits if zero.
+	Digits int
+
+	// Algorithm is the HMAC hash function, SHA1 if empty.
+	Algorithm OTPAlgorithm
+
+	// LookAhead is how many counters after the expected one Verify accepts,
+	// to resynchronize with a token generated without being used.
+	LookAhead uint64
+
+	// Issuer and Account are shown by authenticator apps.
+	Issuer  string
+	Account string
+}
+
+// NewHOTP creates a HOTP with a random secret.
+func NewHOTP(issuer, account string) (*HOTP, error) {
+	secret, err := GenerateOTPSecret(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HOTP{Secret: secret, Issuer: issuer, Account: account}, nil
+}
+
+// Generate returns the code of counter.
+func (h *HOTP) Generate(counter uint64) (string, error) {
+	return generateOTP(h.Secret, counter, h.Digits, h.Algorithm)
+}
+
+// Verify checks code against the counters from counter to counter+LookAhead.
+// It returns the counter to store for the next verification.
+func (h *HOTP) Verify(code string, counter uint64) (uint64, error) {
+	for c := counter; c <= counter+h.LookAhead; c++ {
+		ok, err := verifyOTP(h.Secret, code, c, h.Digits, h.Algorithm)
+		if err != nil {
+			return counter, err
+		}
+		if ok {
+			return c + 1, nil
+		}
+	}
+
+	return counter, ErrInvalidOTP
+}
+
+// ProvisioningURI returns the otpauth:// URI to provision an authenticator
+// app, usually shown as QR code, starting at counter.
+func (h *HOTP) ProvisioningURI(counter uint64) string {
+	params := otpParams(h.Secret, h.Issuer, h.Digits, h.Algorithm)
+	params.Set("counter", strconv.FormatUint(counter, 10))
+
+	return otpURI("hotp", h.Issuer, h.Account, params)
+}
+
+// TOTP generates RFC 6238 time-based one-time passwords.
+type TOTP struct {
+	// Secret is the base32 encoded shared secret.
+	Secret string
+
+	// Digits is the length of the codes, DefaultOTPDigits if zero.
+	Digits int
+
+	// Period is the time step, DefaultOTPPeriod if zero. It must be a whole
+	// number of seconds, as authenticator apps only support seconds.
+	Period time.Duration
+
+	// Algorithm is the HMAC hash function, SHA1 if empty.
+	Algorithm OTPAlgorithm
+
+	// Skew is how many time steps before and after the current one Verify
+	// accepts, to tolerate clock drift.
+	Skew int
+
+	// Issuer and Account are shown by authenticator apps.
+	Issuer  string
+	Account string
+}
+
+// NewTOTP creates a TOTP with a random secret accepting one step of clock drift.
+func NewTOTP(issuer, account string) (*TOTP, error) {
+	secret, err := GenerateOTPSecret(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTP{Secret: secret, Skew: 1, Issuer: issuer, Account: account}, nil
+}
+
+// period returns the period in seconds, or ErrInvalidOTPPeriod if it is
+// negative, shorter than a second or not a whole number of seconds.
+func (t *TOTP) period() (int64, error) {
+	period := t.Period
+	if period == 0 {
+		period = DefaultOTPPeriod
+	}
+	if period < time.Second || period%time.Second != 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidOTPPeriod, t.Period)
+	}
+
+	return int64(period / time.Second), nil
+}
+
+// Step returns the time step of now.
+func (t *TOTP) Step(now time.Time) (uint64, error) {
+	period, err := t.period()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(now.Unix() / period), nil
+}
+
+// Generate returns the code of now.
+func (t *TOTP) Generate(now time.Time) (string, error) {
+	step, err := t.Step(now)
+	if err != nil {
+		return "", err
+	}
+
+	return generateOTP(t.Secret, step, t.Digits, t.Algorithm)
+}
+
+// Verify checks code against the time steps around now, and rejects the steps
+// up to lastStep which have already been used. It returns the matched step,
+// the caller must store it as the lastStep of the next verification.
+func (t *TOTP) Verify(code string, now time.Time, lastStep uint64) (uint64, error) {
+	current, err := t.Step(now)
+	if err != nil {
+		return 0, err
+	}
+	for i := -t.Skew; i <= t.Skew; i++ {
+		if i < 0 && uint64(-i) > current {
+			continue
+		}
+		step := current + uint64(i)
+
+		ok, err := verifyOTP(t.Secret, code, step, t.Digits, t.Algorithm)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if step <= lastStep {
+			return 0, ErrOTPReplayed
+		}
+
+		return step, nil
+	}
+
+	return 0, ErrInvalidOTP
+}
+
+// ProvisioningURI returns the otpauth:// URI to provision an authenticator app,
+// usually shown as QR code.
+func (t *TOTP) ProvisioningURI() (string, error) {
+	period, err := t.period()
+	if err != nil {
+		return "", err
+	}
+	params := otpParams(t.Secret, t.Issuer, t.Digits, t.Algorithm)
+	params.Set("period", strconv.FormatInt(period, 10))
+
+	return otpURI("totp", t.Issuer, t.Account, params), nil
+}
+
+func generateOTP(secret string, counter uint64, digits int, algorithm OTPAlgorithm) (string, error) {
+	key, err := decodeOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	h, err := algorithm.hash()
+	if err != nil {
+		return "", err
+	}
+	if digits <= 0 {
+		digits = DefaultOTPDigits
+	}
+	if digits > 10 {
+		return "", fmt.Errorf("unsupported otp digits %d", digits)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(h, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation of RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	mod := uint64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod), nil
+}
+
+func verifyOTP(secret, code string, counter uint64, digits int, algorithm OTPAlgorithm) (bool, error) {
+	expected, err := generateOTP(secret, counter, digits, algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.TrimSpace(code))) == 1, nil
+}
+
+func otpParams(secret, issuer string, digits int, algorithm OTPAlgorithm) url.Values {
+	if digits <= 0 {
+		digits = DefaultOTPDigits
+	}
+	if algorithm == "" {
+		algorithm = OTPAlgorithmSHA1
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	if issuer != "" {
+		params.Set("issuer", issuer)
+	}
+	params.Set("algorithm", string(algorithm))
+	params.Set("digits", strconv.Itoa(digits))
+
+	return params
+}
+
+func otpURI(kind, issuer, account string, params url.Values) string {
+	label := account
+	if issuer != "" {
+		label = issuer + ":" + account
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     kind,
+		Path:     "/" + label,
+		RawQuery: strings.ReplaceAll(params.Encode(), "+", "%20"),
+	}
+
+	return u.String()
+}
+
+// Define the format of recovery codes, e.g. "k7p2m-xq9ra".
+const (
+	DefaultRecoveryCodes = 10
+	recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	recoveryCodeLength   = 10
+)
+
+// GenerateRecoveryCodes returns n one-time recovery codes to show the user once,
+// and their hashes to store. The codes are hashed with Encrypt.
+func GenerateRecoveryCodes(n int) (codes []string, hashes [][]byte, err error) {
+	if n <= 0 {
+		n = DefaultRecoveryCodes
+	}
+
+	for i := 0; i < n; i++ {
+		text, err := randomText(recoveryCodeLength, recoveryCodeAlphabet)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := text[:recoveryCodeLength/2] + "-" + text[recoveryCodeLength/2:]
+
+		hash, err := Encrypt([]byte(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode checks code against the stored hashes. On success it returns
+// the hashes without the used one, which the caller must store so the code
+// can not be used again.
+func UseRecoveryCode(hashes [][]byte, code string) ([][]byte, error) {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return hashes, ErrInvalidRecoveryCode
+	}
+
+	for i, hash := range hashes {
+		if Compare(hash, []byte(code)) == nil {
+			remaining := make([][]byte, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+
+			return append(remaining, hashes[i+1:]...), nil
+		}
+	}
+
+	return hashes, ErrInvalidRecoveryCode
+}
+
+// normalizeRecoveryCode drops separators and case, as users type them.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the test vectors of RFC 6238.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPGenerate(t *testing.T) {
+	totp := &TOTP{Secret: rfc6238Secret, Digits: 8}
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1234567890, "89005924"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		code, err := totp.Generate(time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("Generate(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestTOTPVerifyReplay(t *testing.T) {
+	totp := &TOTP{Secret: rfc6238Secret, Skew: 1}
+	now := time.Unix(1234567890, 0)
+	code, err := totp.Generate(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, err := totp.Verify(code, now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := totp.Verify(code, now, step); !errors.Is(err, ErrOTPReplayed) {
+		t.Errorf("got %v, want %v", err, ErrOTPReplayed)
+	}
+}
+
+func TestTOTPInvalidPeriod(t *testing.T) {
+	for _, period := range []time.Duration{-time.Second, time.Millisecond, 1500 * time.Millisecond} {
+		totp := &TOTP{Secret: rfc6238Secret, Period: period}
+		if _, err := totp.Generate(time.Now()); !errors.Is(err, ErrInvalidOTPPeriod) {
+			t.Errorf("Generate with period %s: got %v, want %v", period, err, ErrInvalidOTPPeriod)
+		}
+		if _, err := totp.ProvisioningURI(); !errors.Is(err, ErrInvalidOTPPeriod) {
+			t.Errorf("ProvisioningURI with period %s: got %v, want %v", period, err, ErrInvalidOTPPeriod)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining, err := UseRecoveryCode(hashes, strings.ToUpper(codes[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 {
+		t.Fatalf("got %d remaining codes, want 1", len(remaining))
+	}
+	if _, err := UseRecoveryCode(remaining, codes[1]); !errors.Is(err, ErrInvalidRecoveryCode) {
+		t.Errorf("reuse a code: got %v, want %v", err, ErrInvalidRecoveryCode)
+	}
+}
+
+func TestRandomTextUniform(t *testing.T) {
+	const alphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	text, err := randomText(31*10000, alphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[rune]int)
+	for _, c := range text {
+		counts[c]++
+	}
+	// with a modulo bias 8 characters would be drawn about 10900 times
+	for c, n := range counts {
+		if n > 10400 {
+			t.Errorf("%c drawn %d times out of %d", c, n, len(text))
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Define the errors returned when hashing or verifying passwords.
+var (
+	// ErrMismatchedPassword is the same error bcrypt returns, so callers of Compare keep working.
+	ErrMismatchedPassword   = bcrypt.ErrMismatchedHashAndPassword
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+	ErrInvalidHash          = errors.New("invalid password hash")
+)
+
+// PasswordHasher hashes passwords into strings carrying the algorithm and its
+// parameters, in PHC string format or bcrypt's own format.
+type PasswordHasher interface {
+	// IDs returns the algorithm identifiers of the hashes this hasher verifies.
+	IDs() []string
+
+	// Hash hashes password with a random salt.
+	Hash(password []byte) (string, error)
+
+	// Verify returns ErrMismatchedPassword if encoded is not the hash of password.
+	Verify(encoded string, password []byte) error
+
+	// NeedsRehash reports whether encoded was hashed with other parameters than this hasher's.
+	NeedsRehash(encoded string) bool
+}
+
+// Define the bounds of the parameters read from a stored hash, so a corrupt
+// or tampered hash can not verify any password nor use huge memory or CPU.
+const (
+	minSaltLen = 8
+	minHashLen = 16
+	maxHashLen = 128
+
+	maxArgon2Memory  = 1 << 20 // in KiB, 1 GiB
+	maxArgon2Time    = 16
+	maxArgon2Threads = 64
+
+	maxScryptLogN   = 20
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 1 << 30 // 128 * r * N bytes, 1 GiB
+)
+
+// phcHash is a decoded PHC string: $id$v=19$params$salt$hash.
+type phcHash struct {
+	id      string
+	version string
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(encoded string) (*phcHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return nil, ErrInvalidHash
+	}
+
+	h := &phcHash{id: parts[1], params: map[string]int{}}
+	parts = parts[2:]
+	if strings.HasPrefix(parts[0], "v=") {
+		h.version = strings.TrimPrefix(parts[0], "v=")
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return nil, ErrInvalidHash
+	}
+
+	for _, param := range strings.Split(parts[0], ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidHash
+		}
+		value, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, ErrInvalidHash
+		}
+		h.params[kv[0]] = value
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if h.hash, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if len(h.salt) < minSaltLen || len(h.hash) < minHashLen || len(h.hash) > maxHashLen {
+		return nil, ErrInvalidHash
+	}
+
+	return h, nil
+}
+
+func compareHash(a, b []byte) error {
+	if subtle.ConstantTimeCompare(a, b) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+// Argon2idHasher hashes passwords with argon2id.
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen int
+}
+
+var _ PasswordHasher = &Argon2idHasher{}
+
+// NewArgon2idHasher creates an Argon2idHasher with the parameters recommended by RFC 9106.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+}
+
+// IDs returns the algorithm identifiers of the hashes this hasher verifies.
+func (h *Argon2idHasher) IDs() []string { return []string{"argon2id"} }
+
+// Hash hashes password with a random salt, it returns ErrEmptyPassword if password is empty.
+func (h *Argon2idHasher) Hash(password []byte) (string, error) {
+	if err := checkHashable(password, 0); err != nil {
+		return "", err
+	}
+	salt, err := randomBytes(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(password, salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify verifies password against encoded with the parameters stored in encoded.
+func (h *Argon2idHasher) Verify(encoded string, password []byte) error {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return err
+	}
+	if phc.id != "argon2id" || phc.version != fmt.Sprint(argon2.Version) {
+		return ErrUnknownHashAlgorithm
+	}
+	m, t, p := phc.params["m"], phc.params["t"], phc.params["p"]
+	if m <= 0 || m > maxArgon2Memory || t <= 0 || t > maxArgon2Time || p <= 0 || p > maxArgon2Threads {
+		return ErrInvalidHash
+	}
+	key := argon2.IDKey(password, phc.salt, uint32(t), uint32(m), uint8(p), uint32(len(phc.hash)))
+
+	return compareHash(key, phc.hash)
+}
+
+// NeedsRehash reports whether encoded was hashed with other parameters.
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.id != "argon2id" || phc.version != fmt.Sprint(argon2.Version) {
+		return true
+	}
+
+	return phc.params["m"] != int(h.Memory) || phc.params["t"] != int(h.Time) ||
+		phc.params["p"] != int(h.Threads) || len(phc.hash) != int(h.KeyLen) || len(phc.salt) != h.SaltLen
+}
+
+// ScryptHasher hashes passwords with scrypt.
+type ScryptHasher struct {
+	LogN    uint8 // N = 2^LogN
+	R       int
+	P       int
+	KeyLen  int
+	SaltLen int
+}
+
+var _ PasswordHasher = &ScryptHasher{}
+
+// NewScryptHasher creates a ScryptHasher with N=32768, r=8 and p=1.
+func NewScryptHasher() *ScryptHasher {
+	return &ScryptHasher{LogN: 15, R: 8, P: 1, KeyLen: 32, SaltLen: 16}
+}
+
+// IDs returns the algorithm identifiers of the hashes this hasher verifies.
+func (h *ScryptHasher) IDs() []string { return []string{"scrypt"} }
+
+// Hash hashes password with a random salt, it returns ErrEmptyPassword if password is empty.
+func (h *ScryptHasher) Hash(password []byte) (string, error) {
+	if err := checkHashable(password, 0); err != nil {
+		return "", err
+	}
+	salt, err := randomBytes(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key(password, salt, 1<<h.LogN, h.R, h.P, h.KeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.LogN, h.R, h.P,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify verifies password against encoded with the parameters stored in encoded.
+func (h *ScryptHasher) Verify(encoded string, password []byte) error {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return err
+	}
+	if phc.id != "scrypt" {
+		return ErrUnknownHashAlgorithm
+	}
+	ln, r, p := phc.params["ln"], phc.params["r"], phc.params["p"]
+	if ln <= 0 || ln > maxScryptLogN || r <= 0 || r > maxScryptR || p <= 0 || p > maxScryptP ||
+		128*r<<ln > maxScryptMemory {
+		return ErrInvalidHash
+	}
+	key, err := scrypt.Key(password, phc.salt, 1<<ln, r, p, len(phc.hash))
+	if err != nil {
+		return ErrInvalidHash
+	}
+
+	return compareHash(key, phc.hash)
+}
+
+// NeedsRehash reports whether encoded was hashed with other parameters.
+func (h *ScryptHasher) NeedsRehash(encoded string) bool {
+	phc, err := parsePHC(encoded)
+	if err != nil || phc.id != "scrypt" {
+		return true
+	}
+
+	return phc.params["ln"] != int(h.LogN) || phc.params["r"] != h.R || phc.params["p"] != h.P ||
+		len(phc.hash) != h.KeyLen || len(phc.salt) != h.SaltLen
+}
+
+// BcryptHasher hashes passwords with bcrypt, the hashes are in bcrypt's own format.
+type BcryptHasher struct {
+	Cost int
+}
+
+var _ PasswordHasher = &BcryptHasher{}
+
+// NewBcryptHasher creates a BcryptHasher with bcrypt.DefaultCost.
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+// IDs returns the algorithm identifiers of the hashes this hasher verifies.
+func (h *BcryptHasher) IDs() []string { return []string{"2a", "2b", "2y"} }
+
+// Hash hashes password with a random salt. It returns ErrEmptyPassword if
+// password is empty, or ErrPasswordTooLong if it exceeds MaxBcryptPasswordLength
+// bytes instead of letting bcrypt ignore the rest.
+func (h *BcryptHasher) Hash(password []byte) (string, error) {
+	if err := checkHashable(password, MaxBcryptPasswordLength); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword(password, h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Verify verifies password against encoded.
+func (h *BcryptHasher) Verify(encoded string, password []byte) error {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), password)
+}
+
+// NeedsRehash reports whether encoded was hashed with another cost.
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != h.Cost
+}
+
+// PasswordManager hashes new passwords with its preferred hasher, and verifies
+// the hashes of every hasher it knows about.
+type PasswordManager struct {
+	preferred PasswordHasher
+	hashers   map[string]PasswordHasher
+}
+
+// NewPasswordManager creates a PasswordManager hashing with preferred and
+// also verifying the hashes of others.
+func NewPasswordManager(preferred PasswordHasher, others ...PasswordHasher) *PasswordManager {
+	m := &PasswordManager{preferred: preferred, hashers: map[string]PasswordHasher{}}
+	for _, hasher := range append(others, preferred) {
+		for _, id := range hasher.IDs() {
+			m.hashers[id] = hasher
+		}
+	}
+
+	return m
+}
+
+// DefaultPasswordManager hashes with argon2id and verifies argon2id, scrypt and bcrypt hashes.
+var DefaultPasswordManager = NewPasswordManager(NewArgon2idHasher(), NewScryptHasher(), NewBcryptHasher())
+
+// Hash hashes password with the preferred hasher.
+func (m *PasswordManager) Hash(password []byte) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+// Verify verifies password against encoded. needsRehash reports whether the
+// password should be hashed again with Hash and stored, e.g. on login.
+func (m *PasswordManager) Verify(encoded string, password []byte) (needsRehash bool, err error) {
+	hasher, err := m.hasher(encoded)
+	if err != nil {
+		return false, err
+	}
+	if err := hasher.Verify(encoded, password); err != nil {
+		return false, err
+	}
+
+	return m.NeedsRehash(encoded), nil
+}
+
+// NeedsRehash reports whether encoded was not hashed by the preferred hasher with its parameters.
+func (m *PasswordManager) NeedsRehash(encoded string) bool {
+	hasher, err := m.hasher(encoded)
+	if err != nil || hasher != m.preferred {
+		return true
+	}
+
+	return hasher.NeedsRehash(encoded)
+}
+
+func (m *PasswordManager) hasher(encoded string) (PasswordHasher, error) {
+	parts := strings.SplitN(encoded, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return nil, ErrInvalidHash
+	}
+
+	hasher, ok := m.hashers[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownHashAlgorithm, parts[1])
+	}
+
+	return hasher, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := []PasswordHasher{
+		NewArgon2idHasher(),
+		&ScryptHasher{LogN: 10, R: 8, P: 1, KeyLen: 32, SaltLen: 16},
+		&BcryptHasher{Cost: 4},
+	}
+	for _, hasher := range hashers {
+		t.Run(hasher.IDs()[0], func(t *testing.T) {
+			encoded, err := hasher.Hash([]byte("password"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := hasher.Verify(encoded, []byte("password")); err != nil {
+				t.Errorf("verify the password: %v", err)
+			}
+			if err := hasher.Verify(encoded, []byte("wrong")); !errors.Is(err, ErrMismatchedPassword) {
+				t.Errorf("verify a wrong password: got %v, want %v", err, ErrMismatchedPassword)
+			}
+			if hasher.NeedsRehash(encoded) {
+				t.Error("a fresh hash needs rehash")
+			}
+		})
+	}
+}
+
+func TestCompareInvalidHash(t *testing.T) {
+	salt, hash := "c2FsdHNhbHRzYWx0c2FsdA", "aGFzaGhhc2hoYXNoaGFzaGhhc2hoYXNoaGFzaGhhc2g"
+	tests := []string{
+		"$scrypt$ln=4,r=8,p=1$c2FsdHNhbHQ$",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$",
+		"$scrypt$ln=4,r=8,p=1$" + salt + "$",
+		"$scrypt$ln=4,r=8,p=1$$" + hash,
+		"$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$",
+		"$argon2id$v=19$m=65536,t=3,p=4$$" + hash,
+		"$argon2id$v=19$m=4194304,t=3,p=4$" + salt + "$" + hash,
+		"$argon2id$v=19$m=65536,t=1000,p=4$" + salt + "$" + hash,
+		"$argon2id$v=19$m=65536,t=3,p=255$" + salt + "$" + hash,
+		"$scrypt$ln=30,r=8,p=1$" + salt + "$" + hash,
+		"$scrypt$ln=20,r=32,p=1$" + salt + "$" + hash,
+		"$scrypt$ln=10,r=8,p=1000$" + salt + "$" + hash,
+		"$scrypt$ln=10,r=0,p=1$" + salt + "$" + hash,
+	}
+	for _, encoded := range tests {
+		if err := Compare([]byte(encoded), []byte("anything")); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Compare(%q): got %v, want %v", encoded, err, ErrInvalidHash)
+		}
+	}
+}
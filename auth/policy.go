@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBcryptPasswordLength is the number of bytes bcrypt hashes, the rest of a password is ignored.
+const MaxBcryptPasswordLength = 72
+
+// Define the errors returned when hashing a password no policy would accept.
+var (
+	ErrEmptyPassword   = errors.New("password is empty")
+	ErrPasswordTooLong = errors.New("password is longer than the 72 bytes bcrypt hashes")
+)
+
+// checkHashable returns ErrEmptyPassword if password is empty, or
+// ErrPasswordTooLong if it exceeds maxBytes, unless maxBytes is 0. The hashers
+// check it as a last resort, validate passwords with a PasswordPolicy first.
+func checkHashable(password []byte, maxBytes int) error {
+	if len(password) == 0 {
+		return ErrEmptyPassword
+	}
+	if maxBytes > 0 && len(password) > maxBytes {
+		return ErrPasswordTooLong
+	}
+
+	return nil
+}
+
+// Define the codes of password policy violations.
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationInvalidUTF8   = "invalid_utf8"
+	ViolationMissingUpper  = "missing_upper"
+	ViolationMissingLower  = "missing_lower"
+	ViolationMissingDigit  = "missing_digit"
+	ViolationMissingSymbol = "missing_symbol"
+	ViolationTooFewClasses = "too_few_classes"
+	ViolationBanned        = "banned_substring"
+	ViolationBreached      = "breached"
+)
+
+// Violation is a rule of the password policy a password breaks.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError is returned when a password breaks the password policy.
+type PolicyError struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Error implements the error interface.
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+
+	return "password policy violated: " + strings.Join(messages, "; ")
+}
+
+// BreachChecker checks passwords against known breached passwords.
+type BreachChecker interface {
+	IsBreached(password []byte) (bool, error)
+}
+
+// PasswordPolicy validates passwords before they are hashed.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+
+	// MaxBytes is the maximum number of bytes, it must not exceed
+	// MaxBcryptPasswordLength when passwords are hashed with bcrypt.
+	MaxBytes int
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// MinCharClasses is the minimum number of the classes upper, lower, digit
+	// and symbol the password must contain.
+	MinCharClasses int
+
+	// BannedSubstrings are rejected case insensitively, e.g. the product name.
+	BannedSubstrings []string
+
+	// BreachChecker rejects known breached passwords, nil disables the check.
+	BreachChecker BreachChecker
+}
+
+// DefaultPasswordPolicy returns a policy requiring 8 to 72 bytes and 3 character classes.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:      8,
+		MaxBytes:       MaxBcryptPasswordLength,
+		MinCharClasses: 3,
+	}
+}
+
+// Validate returns a *PolicyError if password breaks the policy. userInputs such
+// as the username or email are banned from the password like BannedSubstrings.
+func (p *PasswordPolicy) Validate(password []byte, userInputs ...string) error {
+	violations, err := p.Check(password, userInputs...)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Check returns all the violations of password, the error is only set if the
+// breach check fails.
+func (p *PasswordPolicy) Check(password []byte, userInputs ...string) ([]Violation, error) {
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !utf8.Valid(password) {
+		add(ViolationInvalidUTF8, "password must be valid UTF-8")
+
+		return violations, nil
+	}
+
+	if n := utf8.RuneCount(password); n < p.MinLength || n == 0 {
+		add(ViolationTooShort, "password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		add(ViolationTooLong, "password must be at most %d bytes", p.MaxBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range string(password) {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add(ViolationMissingUpper, "password must contain an upper case letter")
+	}
+	if p.RequireLower && !lower {
+		add(ViolationMissingLower, "password must contain a lower case letter")
+	}
+	if p.RequireDigit && !digit {
+		add(ViolationMissingDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(ViolationMissingSymbol, "password must contain a symbol")
+	}
+	if classes := countTrue(upper, lower, digit, symbol); classes < p.MinCharClasses {
+		add(ViolationTooFewClasses, "password must contain %d of upper case letters, lower case letters, digits and symbols",
+			p.MinCharClasses)
+	}
+
+	lowered := strings.ToLower(string(password))
+	for _, banned := range p.BannedSubstrings {
+		if banned != "" && strings.Contains(lowered, strings.ToLower(banned)) {
+			add(ViolationBanned, "password must not contain %q", banned)
+		}
+	}
+	for _, input := range userInputs {
+		// too short inputs would reject too many passwords
+		if utf8.RuneCountInString(input) >= 3 && strings.Contains(lowered, strings.ToLower(input)) {
+			add(ViolationBanned, "password must not contain your personal information")
+		}
+	}
+
+	if p.BreachChecker != nil {
+		breached, err := p.BreachChecker.IsBreached(password)
+		if err != nil {
+			return violations, fmt.Errorf("check breached password: %w", err)
+		}
+		if breached {
+			add(ViolationBreached, "password has appeared in a data breach")
+		}
+	}
+
+	return violations, nil
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+
+	return n
+}
+
+// sha1Hex returns the upper case hex encoded sha1 of password, as used by breached password lists.
+func sha1Hex(password []byte) string {
+	sum := sha1.Sum(password)
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// BreachedPasswordList is a BreachChecker holding the sha1 hashes of breached passwords.
+type BreachedPasswordList struct {
+	hashes map[string]struct{}
+}
+
+var _ BreachChecker = &BreachedPasswordList{}
+
+// LoadBreachedPasswordList loads a file of sha1 hashes, one `HASH` or `HASH:COUNT` per line.
+func LoadBreachedPasswordList(file string) (*BreachedPasswordList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &BreachedPasswordList{hashes: make(map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, err := parseHashLine(scanner.Text(), sha1.Size*2)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if hash != "" {
+			l.hashes[hash] = struct{}{}
+		}
+	}
+
+	return l, scanner.Err()
+}
+
+// IsBreached reports whether password is in the list.
+func (l *BreachedPasswordList) IsBreached(password []byte) (bool, error) {
+	_, ok := l.hashes[sha1Hex(password)]
+
+	return ok, nil
+}
+
+// BreachedPrefixDir is a BreachChecker backed by a directory of k-anonymity
+// range files: each file is named by the first 5 hex characters of the sha1
+// hash, optionally with a .txt extension, and lists the 35 characters long
+// remaining suffixes as `SUFFIX:COUNT` lines.
+type BreachedPrefixDir struct {
+	dir string
+}
+
+var _ BreachChecker = &BreachedPrefixDir{}
+
+// NewBreachedPrefixDir creates a BreachedPrefixDir reading the range files in dir.
+func NewBreachedPrefixDir(dir string) *BreachedPrefixDir {
+	return &BreachedPrefixDir{dir: dir}
+}
+
+// IsBreached reports whether the suffix of the hash of password is in its range file.
+func (d *BreachedPrefixDir) IsBreached(password []byte) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(d.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, err := parseHashLine(scanner.Text(), len(suffix))
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		if line == suffix {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// parseHashLine returns the upper case hash of a `HASH[:COUNT]` line, or an
+// empty string for blank lines.
+func parseHashLine(line string, size int) (string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", nil
+	}
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	if len(line) != size || strings.Trim(line, "0123456789abcdefABCDEF") != "" {
+		return "", fmt.Errorf("invalid hash line %q", line)
+	}
+
+	return strings.ToUpper(line), nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:        8,
+		MaxBytes:         MaxBcryptPasswordLength,
+		RequireDigit:     true,
+		MinCharClasses:   3,
+		BannedSubstrings: []string{"gotool"},
+	}
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		want       []string
+	}{
+		{"valid", "Correct-Horse-9", nil, nil},
+		{"empty", "", nil, []string{ViolationTooShort, ViolationMissingDigit, ViolationTooFewClasses}},
+		{"too short", "Ab-9", nil, []string{ViolationTooShort}},
+		{"too long", "Ab-9" + strings.Repeat("x", MaxBcryptPasswordLength), nil, []string{ViolationTooLong}},
+		{"multibyte characters count once", "Ünïcödé-9", nil, nil},
+		{"invalid utf8", "Abcdefg-9\xff", nil, []string{ViolationInvalidUTF8}},
+		{"missing digit", "Correct-Horse", nil, []string{ViolationMissingDigit}},
+		{"too few classes", "correcthorse9", nil, []string{ViolationTooFewClasses}},
+		{"banned substring", "My-GoTool-9", nil, []string{ViolationBanned}},
+		{"user input", "Alice-Pass-9", []string{"alice"}, []string{ViolationBanned}},
+		{"short user input", "Al-Pass-9xx", []string{"al"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check([]byte(tt.password), tt.userInputs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codes []string
+			for _, v := range violations {
+				codes = append(codes, v.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.want) {
+				t.Errorf("got violations %v, want %v", codes, tt.want)
+			}
+
+			err = policy.Validate([]byte(tt.password), tt.userInputs...)
+			var policyErr *PolicyError
+			if (len(tt.want) > 0) != errors.As(err, &policyErr) {
+				t.Errorf("Validate: got %v", err)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestBreachedPasswordList(t *testing.T) {
+	dir := t.TempDir()
+	breached := sha1Hex([]byte("password1"))
+
+	file := writeFile(t, dir, "list.txt", strings.ToLower(breached)+":42\n\n"+sha1Hex([]byte("other"))+"\n")
+	list, err := LoadBreachedPasswordList(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &PasswordPolicy{BreachChecker: list}
+	violations, err := policy.Check([]byte("password1"))
+	if err != nil || len(violations) != 1 || violations[0].Code != ViolationBreached {
+		t.Errorf("breached password: got %v, %v", violations, err)
+	}
+	if breached, _ := list.IsBreached([]byte("password2")); breached {
+		t.Error("password2 is not in the list")
+	}
+
+	for _, line := range []string{"not a hash", breached[:39], breached + "0"} {
+		if _, err := LoadBreachedPasswordList(writeFile(t, dir, "malformed.txt", line+"\n")); err == nil {
+			t.Errorf("loaded the malformed line %q", line)
+		}
+	}
+}
+
+func TestBreachedPrefixDir(t *testing.T) {
+	dir := t.TempDir()
+	hash1, hash2 := sha1Hex([]byte("password1")), sha1Hex([]byte("password2"))
+	writeFile(t, dir, hash1[:5], "0000000000000000000000000000000000A:1\n"+hash1[5:]+":42\n")
+	writeFile(t, dir, hash2[:5]+".txt", strings.ToLower(hash2[5:])+":7\n")
+
+	d := NewBreachedPrefixDir(dir)
+	for _, password := range []string{"password1", "password2"} {
+		if breached, err := d.IsBreached([]byte(password)); err != nil || !breached {
+			t.Errorf("%s: got %v, %v, want breached", password, breached, err)
+		}
+	}
+	if breached, err := d.IsBreached([]byte("password3")); err != nil || breached {
+		t.Errorf("password without range file: got %v, %v", breached, err)
+	}
+
+	hash3 := sha1Hex([]byte("password3"))
+	writeFile(t, dir, hash3[:5], "not a suffix:1\n")
+	if _, err := d.IsBreached([]byte("password3")); err == nil {
+		t.Error("read a malformed range file")
+	}
+}
+
+func TestHashUnhashablePasswords(t *testing.T) {
+	long := []byte(strings.Repeat("x", MaxBcryptPasswordLength+1))
+	tests := []struct {
+		name     string
+		hash     func(password []byte) error
+		password []byte
+		want     error
+	}{
+		{"bcrypt empty", hashWith(NewBcryptHasher()), nil, ErrEmptyPassword},
+		{"bcrypt too long", hashWith(NewBcryptHasher()), long, ErrPasswordTooLong},
+		{"argon2id empty", hashWith(NewArgon2idHasher()), nil, ErrEmptyPassword},
+		{"scrypt empty", hashWith(NewScryptHasher()), nil, ErrEmptyPassword},
+		{"encrypt empty", encryptErr, nil, ErrEmptyPassword},
+		{"encrypt too long", encryptErr, long, ErrPasswordTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hash(tt.password); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func hashWith(h PasswordHasher) func(password []byte) error {
+	return func(password []byte) error {
+		_, err := h.Hash(password)
+
+		return err
+	}
+}
+
+func encryptErr(password []byte) error {
+	_, err := Encrypt(password)
+
+	return err
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// alphanumeric is the alphabet of RandomID.
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// randomBytes returns n cryptographically random bytes.
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// randomString returns n random bytes encoded in base64url.
+func randomString(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// randomText returns a cryptographically random string of length n drawn
+// uniformly from alphabet, which has at most 256 characters. The random bytes
+// above the largest multiple of the alphabet size are rejected, so that no
+// character is more likely than the others.
+func randomText(n int, alphabet string) (string, error) {
+	if n <= 0 {
+		return "", errors.New("invalid random text length")
+	}
+
+	limit := 256 - 256%len(alphabet)
+	text := make([]byte, 0, n)
+	for len(text) < n {
+		b, err := randomBytes(n - len(text))
+		if err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if int(c) < limit {
+				text = append(text, alphabet[int(c)%len(alphabet)])
+			}
+		}
+	}
+
+	return string(text), nil
+}
+
+// RandomID returns a cryptographically random alphanumeric string of length n.
+func RandomID(n int) (string, error) {
+	return randomText(n, alphanumeric)
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Define the errors returned when a refresh token is rejected.
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token is expired")
+	ErrRefreshTokenRevoked  = errors.New("refresh token is revoked")
+	ErrRefreshTokenReused   = errors.New("refresh token is reused")
+)
+
+// DefaultRefreshTTL is the default lifetime of a refresh token.
+const DefaultRefreshTTL = 30 * 24 * time.Hour
+
+// RefreshToken is the stored form of an opaque refresh token, only the hash of
+// the token is stored. All tokens rotated from the same login share a family.
+// The GormRefreshTokenStore ignores DeletedAt, so soft deleting a token does
+// not hide it from the reuse detection; tokens are revoked, not deleted.
+type RefreshToken struct {
+	// May add TypeMeta in the future.
+	// metav1.TypeMeta `json:",inline"`
+
+	// Standard object's metadata.
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// TokenHash is the hex encoded sha256 of the token.
+	TokenHash string `json:"-" gorm:"column:tokenHash;type:varchar(64);uniqueIndex;not null"`
+
+	// FamilyID identifies the tokens rotated from the same login.
+	FamilyID string `json:"familyID" gorm:"column:familyID;type:varchar(32);index;not null"`
+
+	// Subject is the owner of the token.
+	Subject string `json:"subject" gorm:"column:subject;type:varchar(64);index;not null"`
+
+	// ExpiresAt is the time from which the token can not be used.
+	ExpiresAt time.Time `json:"expiresAt" gorm:"column:expiresAt"`
+
+	// RotatedAt is the time the token was exchanged for a new one.
+	RotatedAt *time.Time `json:"rotatedAt,omitempty" gorm:"column:rotatedAt"`
+
+	// RevokedAt is the time the token family was revoked.
+	RevokedAt *time.Time `json:"revokedAt,omitempty" gorm:"column:revokedAt"`
+}
+
+// TableName maps to mysql table name.
+func (t *RefreshToken) TableName() string {
+	return "refresh_token"
+}
+
+// RefreshTokenStore persists refresh tokens.
+type RefreshTokenStore interface {
+	// Create stores a new refresh token.
+	Create(ctx context.Context, token *RefreshToken) error
+
+	// Get returns the refresh token by its hash, or ErrRefreshTokenNotFound.
+	Get(ctx context.Context, tokenHash string) (*RefreshToken, error)
+
+	// MarkRotated marks the token as rotated at the given time. It must be atomic,
+	// ErrRefreshTokenReused is returned if the token was rotated or revoked before.
+	MarkRotated(ctx context.Context, tokenHash string, at time.Time) error
+
+	// RevokeFamily revokes all tokens of the family.
+	RevokeFamily(ctx context.Context, familyID string, at time.Time) error
+}
+
+// RefreshManager issues and rotates refresh tokens. A token can be used only
+// once, presenting a rotated token again revokes its whole family.
+type RefreshManager struct {
+	store RefreshTokenStore
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// RefreshOption defines optional parameters for a RefreshManager.
+type RefreshOption func(*RefreshManager)
+
+// WithRefreshTTL sets the lifetime of the refresh tokens.
+func WithRefreshTTL(ttl time.Duration) RefreshOption {
+	return func(m *RefreshManager) {
+		m.ttl = ttl
+	}
+}
+
+// NewRefreshManager creates a RefreshManager storing the tokens in store.
+func NewRefreshManager(store RefreshTokenStore, opts ...RefreshOption) *RefreshManager {
+	m := &RefreshManager{
+		store: store,
+		ttl:   DefaultRefreshTTL,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Issue issues a refresh token starting a new family for subject.
+func (m *RefreshManager) Issue(ctx context.Context, subject string) (string, *RefreshToken, error) {
+	familyID, err := randomString(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return m.issue(ctx, subject, familyID)
+}
+
+// Rotate exchanges token for a new refresh token of the same family.
+// The returned RefreshToken tells the subject to issue an access token for.
+func (m *RefreshManager) Rotate(ctx context.Context, token string) (string, *RefreshToken, error) {
+	rt, err := m.store.Get(ctx, HashRefreshToken(token))
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := m.now()
+	switch {
+	case rt.RevokedAt != nil:
+		return "", nil, ErrRefreshTokenRevoked
+	case rt.RotatedAt != nil:
+		return "", nil, m.revokeReused(ctx, rt, now)
+	case !now.Before(rt.ExpiresAt):
+		return "", nil, ErrRefreshTokenExpired
+	}
+
+	if err := m.store.MarkRotated(ctx, rt.TokenHash, now); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			// lost the race against another use of the same token
+			return "", nil, m.revokeReused(ctx, rt, now)
+		}
+
+		return "", nil, err
+	}
+
+	return m.issue(ctx, rt.Subject, rt.FamilyID)
+}
+
+// Revoke revokes the family of token, e.g. on logout.
+func (m *RefreshManager) Revoke(ctx context.Context, token string) error {
+	rt, err := m.store.Get(ctx, HashRefreshToken(token))
+	if err != nil {
+		return err
+	}
+
+	return m.store.RevokeFamily(ctx, rt.FamilyID, m.now())
+}
+
+func (m *RefreshManager) revokeReused(ctx context.Context, rt *RefreshToken, now time.Time) error {
+	if err := m.store.RevokeFamily(ctx, rt.FamilyID, now); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+func (m *RefreshManager) issue(ctx context.Context, subject, familyID string) (string, *RefreshToken, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	instanceID, err := randomString(12)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rt := &RefreshToken{
+		ObjectMeta: metav1.ObjectMeta{
+			InstanceID: "rt-" + instanceID,
+			Name:       familyID,
+		},
+		TokenHash: HashRefreshToken(token),
+		FamilyID:  familyID,
+		Subject:   subject,
+		ExpiresAt: m.now().Add(m.ttl),
+	}
+	if err := m.store.Create(ctx, rt); err != nil {
+		return "", nil, err
+	}
+
+	return token, rt, nil
+}
+
+// HashRefreshToken returns the hash under which token is stored.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
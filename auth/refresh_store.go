@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryRefreshTokenStore is a RefreshTokenStore keeping the tokens in memory.
+type MemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*RefreshToken
+}
+
+var _ RefreshTokenStore = &MemoryRefreshTokenStore{}
+
+// NewMemoryRefreshTokenStore creates an empty MemoryRefreshTokenStore.
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{tokens: make(map[string]*RefreshToken)}
+}
+
+// Create stores a new refresh token.
+func (s *MemoryRefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt := *token
+	now := time.Now()
+	rt.CreatedAt, rt.UpdatedAt = now, now
+	s.tokens[rt.TokenHash] = &rt
+
+	return nil
+}
+
+// Get returns the refresh token by its hash.
+func (s *MemoryRefreshTokenStore) Get(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[tokenHash]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	copied := *rt
+
+	return &copied, nil
+}
+
+// MarkRotated marks the token as rotated.
+func (s *MemoryRefreshTokenStore) MarkRotated(ctx context.Context, tokenHash string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[tokenHash]
+	if !ok {
+		return ErrRefreshTokenNotFound
+	}
+	if rt.RotatedAt != nil || rt.RevokedAt != nil {
+		return ErrRefreshTokenReused
+	}
+	rt.RotatedAt = &at
+	rt.UpdatedAt = at
+
+	return nil
+}
+
+// RevokeFamily revokes all tokens of the family.
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rt := range s.tokens {
+		if rt.FamilyID == familyID && rt.RevokedAt == nil {
+			rt.RevokedAt = &at
+			rt.UpdatedAt = at
+		}
+	}
+
+	return nil
+}
+
+// GormRefreshTokenStore is a RefreshTokenStore backed by gorm, it reads and
+// updates the soft deleted tokens too.
+type GormRefreshTokenStore struct {
+	db *gorm.DB
+}
+
+var _ RefreshTokenStore = &GormRefreshTokenStore{}
+
+// NewGormRefreshTokenStore creates a GormRefreshTokenStore using db.
+func NewGormRefreshTokenStore(db *gorm.DB) *GormRefreshTokenStore {
+	return &GormRefreshTokenStore{db: db}
+}
+
+// Create stores a new refresh token.
+func (s *GormRefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+// Get returns the refresh token by its hash.
+func (s *GormRefreshTokenStore) Get(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	rt := &RefreshToken{}
+	err := s.db.WithContext(ctx).Unscoped().Where(s.db.Statement.Quote("tokenHash")+" = ?", tokenHash).First(rt).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenNotFound
+		}
+
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// MarkRotated marks the token as rotated, only if it is neither rotated nor revoked yet.
+func (s *GormRefreshTokenStore) MarkRotated(ctx context.Context, tokenHash string, at time.Time) error {
+	q := s.db.Statement.Quote
+	result := s.db.WithContext(ctx).Unscoped().Model(&RefreshToken{}).
+		Where(q("tokenHash")+" = ? AND "+q("rotatedAt")+" IS NULL AND "+q("revokedAt")+" IS NULL", tokenHash).
+		UpdateColumns(map[string]interface{}{"rotatedAt": at, "updatedAt": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	return nil
+}
+
+// RevokeFamily revokes all tokens of the family.
+func (s *GormRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	q := s.db.Statement.Quote
+	return s.db.WithContext(ctx).Unscoped().Model(&RefreshToken{}).
+		Where(q("familyID")+" = ? AND "+q("revokedAt")+" IS NULL", familyID).
+		UpdateColumns(map[string]interface{}{"revokedAt": at, "updatedAt": at}).Error
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an in-memory sqlite database with the tables of models.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection opens another in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func refreshTokenStores(t *testing.T) map[string]func() RefreshTokenStore {
+	return map[string]func() RefreshTokenStore{
+		"memory": func() RefreshTokenStore { return NewMemoryRefreshTokenStore() },
+		"gorm":   func() RefreshTokenStore { return NewGormRefreshTokenStore(newTestDB(t, &RefreshToken{})) },
+	}
+}
+
+func TestRefreshRotate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// use presents the tokens of a family, issued is the first one
+		use  func(m *RefreshManager, issued string) error
+		want error
+	}{
+		{"rotate", func(m *RefreshManager, issued string) error {
+			rotated, _, err := m.Rotate(ctx, issued)
+			if err != nil {
+				return err
+			}
+			_, _, err = m.Rotate(ctx, rotated)
+
+			return err
+		}, nil},
+		{"unknown token", func(m *RefreshManager, issued string) error {
+			_, _, err := m.Rotate(ctx, "unknown")
+
+			return err
+		}, ErrRefreshTokenNotFound},
+		{"reused token", func(m *RefreshManager, issued string) error {
+			if _, _, err := m.Rotate(ctx, issued); err != nil {
+				return err
+			}
+			_, _, err := m.Rotate(ctx, issued)
+
+			return err
+		}, ErrRefreshTokenReused},
+		{"reuse revokes the family", func(m *RefreshManager, issued string) error {
+			rotated, _, err := m.Rotate(ctx, issued)
+			if err != nil {
+				return err
+			}
+			if _, _, err := m.Rotate(ctx, issued); !errors.Is(err, ErrRefreshTokenReused) {
+				return err
+			}
+			_, _, err = m.Rotate(ctx, rotated)
+
+			return err
+		}, ErrRefreshTokenRevoked},
+		{"revoked family", func(m *RefreshManager, issued string) error {
+			if err := m.Revoke(ctx, issued); err != nil {
+				return err
+			}
+			_, _, err := m.Rotate(ctx, issued)
+
+			return err
+		}, ErrRefreshTokenRevoked},
+		{"expired token", func(m *RefreshManager, issued string) error {
+			now := time.Now().Add(DefaultRefreshTTL)
+			m.now = func() time.Time { return now }
+			_, _, err := m.Rotate(ctx, issued)
+
+			return err
+		}, ErrRefreshTokenExpired},
+	}
+	for storeName, newStore := range refreshTokenStores(t) {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				m := NewRefreshManager(newStore())
+				issued, rt, err := m.Issue(ctx, "alice")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rt.Subject != "alice" || rt.TokenHash != HashRefreshToken(issued) {
+					t.Fatalf("unexpected refresh token %+v", rt)
+				}
+
+				if err := tt.use(m, issued); !errors.Is(err, tt.want) {
+					t.Errorf("got %v, want %v", err, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestRefreshRotateConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	for storeName, newStore := range refreshTokenStores(t) {
+		t.Run(storeName, func(t *testing.T) {
+			m := NewRefreshManager(newStore())
+			issued, _, err := m.Issue(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				rotated []string
+			)
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					token, _, err := m.Rotate(ctx, issued)
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil:
+						rotated = append(rotated, token)
+					case !errors.Is(err, ErrRefreshTokenReused) && !errors.Is(err, ErrRefreshTokenRevoked):
+						t.Errorf("unexpected error %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(rotated) != 1 {
+				t.Fatalf("%d concurrent rotations succeeded, want 1", len(rotated))
+			}
+			// the other uses revoked the family of the rotated token
+			if _, _, err := m.Rotate(ctx, rotated[0]); !errors.Is(err, ErrRefreshTokenRevoked) {
+				t.Errorf("got %v, want %v", err, ErrRefreshTokenRevoked)
+			}
+		})
+	}
+}
+
+func TestGormRefreshTokenStoreIgnoresSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, &RefreshToken{})
+	m := NewRefreshManager(NewGormRefreshTokenStore(db))
+
+	issued, _, err := m.Issue(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Rotate(ctx, issued); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("1 = 1").Delete(&RefreshToken{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := m.Rotate(ctx, issued); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("got %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
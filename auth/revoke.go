@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTokenRevoked is returned when a token has been revoked.
+var ErrTokenRevoked = errors.New("token is revoked")
+
+// Revoker revokes tokens before they expire.
+type Revoker interface {
+	// Revoke revokes the token jti, the entry can be dropped after expiresAt.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// RevokeSubject revokes all tokens of subject issued before the given time.
+	RevokeSubject(ctx context.Context, subject string, before time.Time) error
+
+	// IsRevoked reports whether the token with claims is revoked.
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// RevokeClaims revokes the token the claims were parsed from.
+func RevokeClaims(ctx context.Context, revoker Revoker, claims *Claims) error {
+	if claims.ID == "" {
+		return errors.New("token has no jti")
+	}
+
+	expiresAt := time.Now().Add(DefaultTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	return revoker.Revoke(ctx, claims.ID, expiresAt)
+}
+
+// revokedBySubject reports whether a token issued at iat is revoked by a
+// subject revocation at before. Tokens without iat are always revoked.
+func revokedBySubject(claims *Claims, before time.Time) bool {
+	return claims.IssuedAt == nil || !claims.IssuedAt.After(before)
+}
+
+// MemoryRevoker is a Revoker keeping the revocations in memory.
+type MemoryRevoker struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	subjects map[string]time.Time
+	now      func() time.Time
+}
+
+var _ Revoker = &MemoryRevoker{}
+
+// NewMemoryRevoker creates an empty MemoryRevoker.
+func NewMemoryRevoker() *MemoryRevoker {
+	return &MemoryRevoker{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Revoke revokes the token jti until expiresAt.
+func (r *MemoryRevoker) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[jti] = expiresAt
+
+	return nil
+}
+
+// RevokeSubject revokes all tokens of subject issued before the given time.
+func (r *MemoryRevoker) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if before.After(r.subjects[subject]) {
+		r.subjects[subject] = before
+	}
+
+	return nil
+}
+
+// IsRevoked reports whether the token with claims is revoked.
+func (r *MemoryRevoker) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if expiresAt, ok := r.tokens[claims.ID]; ok && claims.ID != "" {
+		if r.now().Before(expiresAt) {
+			return true, nil
+		}
+		delete(r.tokens, claims.ID)
+	}
+
+	if before, ok := r.subjects[claims.Subject]; ok && claims.Subject != "" {
+		return revokedBySubject(claims, before), nil
+	}
+
+	return false, nil
+}
+
+// Cleanup drops the revocations of the expired tokens.
+func (r *MemoryRevoker) Cleanup() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for jti, expiresAt := range r.tokens {
+		if !now.Before(expiresAt) {
+			delete(r.tokens, jti)
+		}
+	}
+}
+
+// RevokedToken is a revoked jti stored by GormRevoker.
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;type:varchar(64);primaryKey"`
+	ExpiresAt time.Time `gorm:"column:expiresAt;index"`
+	CreatedAt time.Time `gorm:"column:createdAt"`
+}
+
+// TableName maps to mysql table name.
+func (t *RevokedToken) TableName() string {
+	return "revoked_token"
+}
+
+// RevokedSubject is a subject revocation stored by GormRevoker.
+type RevokedSubject struct {
+	Subject       string    `gorm:"column:subject;type:varchar(64);primaryKey"`
+	RevokedBefore time.Time `gorm:"column:revokedBefore"`
+	UpdatedAt     time.Time `gorm:"column:updatedAt"`
+}
+
+// TableName maps to mysql table name.
+func (s *RevokedSubject) TableName() string {
+	return "revoked_subject"
+}
+
+// GormRevoker is a Revoker backed by gorm.
+type GormRevoker struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+var _ Revoker = &GormRevoker{}
+
+// NewGormRevoker creates a GormRevoker using db.
+func NewGormRevoker(db *gorm.DB) *GormRevoker {
+	return &GormRevoker{db: db, now: time.Now}
+}
+
+// Revoke revokes the token jti until expiresAt.
+func (r *GormRevoker) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "jti"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expiresAt"}),
+	}).Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// RevokeSubject revokes all tokens of subject issued before the given time.
+func (r *GormRevoker) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	// never move an existing revocation backwards
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"revokedBefore": gorm.Expr("CASE WHEN ? < ? THEN ? ELSE ? END",
+				clause.Column{Name: "revokedBefore"}, before, before, clause.Column{Name: "revokedBefore"}),
+			"updatedAt": r.now(),
+		}),
+	}).Create(&RevokedSubject{Subject: subject, RevokedBefore: before}).Error
+}
+
+// IsRevoked reports whether the token with claims is revoked.
+func (r *GormRevoker) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	db := r.db.WithContext(ctx)
+
+	if claims.ID != "" {
+		var count int64
+		err := db.Model(&RevokedToken{}).
+			Where(db.Statement.Quote("jti")+" = ? AND "+db.Statement.Quote("expiresAt")+" > ?", claims.ID, r.now()).
+			Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	if claims.Subject != "" {
+		var subject RevokedSubject
+		err := db.Where(db.Statement.Quote("subject")+" = ?", claims.Subject).Take(&subject).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		return revokedBySubject(claims, subject.RevokedBefore), nil
+	}
+
+	return false, nil
+}
+
+// Cleanup deletes the revocations of the expired tokens.
+func (r *GormRevoker) Cleanup(ctx context.Context) error {
+	return r.db.WithContext(ctx).Where(r.db.Statement.Quote("expiresAt")+" <= ?", r.now()).Delete(&RevokedToken{}).Error
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestRevoker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	claims := func(jti, subject string, iat time.Time) *Claims {
+		return &Claims{RegisteredClaims: jwt.RegisteredClaims{ID: jti, Subject: subject, IssuedAt: jwt.NewNumericDate(iat)}}
+	}
+
+	revokers := map[string]func() Revoker{
+		"memory": func() Revoker {
+			r := NewMemoryRevoker()
+			r.now = func() time.Time { return now }
+
+			return r
+		},
+		"gorm": func() Revoker {
+			r := NewGormRevoker(newTestDB(t, &RevokedToken{}, &RevokedSubject{}))
+			r.now = func() time.Time { return now }
+
+			return r
+		},
+	}
+	tests := []struct {
+		name   string
+		revoke func(r Revoker) error
+		claims *Claims
+		want   bool
+	}{
+		{"not revoked", func(r Revoker) error { return nil }, claims("jti", "alice", now), false},
+		{"revoked jti", func(r Revoker) error {
+			return r.Revoke(ctx, "jti", now.Add(time.Hour))
+		}, claims("jti", "alice", now), true},
+		{"other jti", func(r Revoker) error {
+			return r.Revoke(ctx, "other", now.Add(time.Hour))
+		}, claims("jti", "alice", now), false},
+		{"expired revocation", func(r Revoker) error {
+			return r.Revoke(ctx, "jti", now.Add(-time.Second))
+		}, claims("jti", "alice", now), false},
+		{"issued before the subject revocation", func(r Revoker) error {
+			return r.RevokeSubject(ctx, "alice", now)
+		}, claims("jti", "alice", now.Add(-time.Minute)), true},
+		{"issued after the subject revocation", func(r Revoker) error {
+			return r.RevokeSubject(ctx, "alice", now)
+		}, claims("jti", "alice", now.Add(time.Minute)), false},
+		{"subject revocation never moves backwards", func(r Revoker) error {
+			if err := r.RevokeSubject(ctx, "alice", now); err != nil {
+				return err
+			}
+
+			return r.RevokeSubject(ctx, "alice", now.Add(-time.Hour))
+		}, claims("jti", "alice", now.Add(-time.Minute)), true},
+		{"other subject", func(r Revoker) error {
+			return r.RevokeSubject(ctx, "bob", now)
+		}, claims("jti", "alice", now.Add(-time.Minute)), false},
+	}
+	for name, newRevoker := range revokers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				r := newRevoker()
+				if err := tt.revoke(r); err != nil {
+					t.Fatal(err)
+				}
+
+				revoked, err := r.IsRevoked(ctx, tt.claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked != tt.want {
+					t.Errorf("got revoked %v, want %v", revoked, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestGormRevokerCleanup(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, &RevokedToken{}, &RevokedSubject{})
+	r := NewGormRevoker(db)
+
+	if err := r.Revoke(ctx, "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revoke(ctx, "valid", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var jtis []string
+	if err := db.Model(&RevokedToken{}).Pluck("jti", &jtis).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jtis) != 1 || jtis[0] != "valid" {
+		t.Errorf("got %v after cleanup, want [valid]", jtis)
+	}
+}
+
+func TestVerifyRevoked(t *testing.T) {
+	ctx := context.Background()
+	keys := NewStaticKeySet(NewHMACKey("id", "key"))
+	token, err := NewKeySetIssuer(keys, "iss", "aud").Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoker := NewMemoryRevoker()
+	v := NewKeySetVerifier(keys, WithRevoker(revoker))
+
+	claims, err := v.VerifyContext(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeClaims(ctx, revoker, claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifyContext(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("got %v, want %v", err, ErrTokenRevoked)
+	}
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Define the errors returned by a KeyManager.
+var (
+	ErrKeyExists     = errors.New("key already exists")
+	ErrVerifyOnlyKey = errors.New("key has no private half to sign with")
+)
+
+// KeyState is the state of a key managed by a KeyManager.
+type KeyState string
+
+// Define the states of a managed key.
+const (
+	// KeyStateActive keys sign new tokens once activated and verify tokens.
+	KeyStateActive KeyState = "active"
+	// KeyStateValid keys only verify tokens.
+	KeyStateValid KeyState = "valid"
+	// KeyStateRetired keys neither sign nor verify tokens.
+	KeyStateRetired KeyState = "retired"
+)
+
+// ManagedKey is a key with its rotation state.
+type ManagedKey struct {
+	*Key
+
+	// State is the state of the key.
+	State KeyState
+
+	// ActivateAt is the time from which an active key is used to sign tokens.
+	ActivateAt time.Time
+
+	// ExpireAt is the time from which the key neither signs nor verifies tokens.
+	// Zero means the key never expires.
+	ExpireAt time.Time
+}
+
+func (k *ManagedKey) canVerify(now time.Time) bool {
+	return k.State != KeyStateRetired && (k.ExpireAt.IsZero() || now.Before(k.ExpireAt))
+}
+
+func (k *ManagedKey) canSign(now time.Time) bool {
+	return k.State == KeyStateActive && k.PrivateKey != nil && !now.Before(k.ActivateAt) && k.canVerify(now)
+}
+
+// KeyManager is a SigningKeySet rotating its keys. It always signs with the
+// newest active key and accepts tokens from every key inside its verification window.
+type KeyManager struct {
+	mu   sync.RWMutex
+	keys map[string]*ManagedKey
+	now  func() time.Time
+}
+
+var (
+	_ SigningKeySet = &KeyManager{}
+	_ KeyLister     = &KeyManager{}
+)
+
+// KeyManagerOption defines optional parameters for a KeyManager.
+type KeyManagerOption func(*KeyManager)
+
+// WithRotationClock sets the function used to get the current time.
+func WithRotationClock(now func() time.Time) KeyManagerOption {
+	return func(m *KeyManager) {
+		m.now = now
+	}
+}
+
+// NewKeyManager creates a KeyManager holding keys.
+func NewKeyManager(keys []*ManagedKey, opts ...KeyManagerOption) (*KeyManager, error) {
+	m := &KeyManager{
+		keys: make(map[string]*ManagedKey, len(keys)),
+		now:  time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	for _, key := range keys {
+		if err := m.Add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Add adds a key to the manager.
+func (m *KeyManager) Add(key *ManagedKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.keys[key.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrKeyExists, key.ID)
+	}
+	m.keys[key.ID] = key
+
+	return nil
+}
+
+// Rotate adds key as the new active signing key. The keys active before are
+// demoted to verification only and expire after overlap, which should be no
+// shorter than the lifetime of the issued tokens. A key without private
+// half is rejected with ErrVerifyOnlyKey, use Add to only verify with it.
+func (m *KeyManager) Rotate(key *Key, overlap time.Duration) error {
+	if key.PrivateKey == nil {
+		return fmt.Errorf("%w: %s", ErrVerifyOnlyKey, key.ID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.keys[key.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrKeyExists, key.ID)
+	}
+
+	now := m.now()
+	expireAt := now.Add(overlap)
+	for _, k := range m.keys {
+		if k.State != KeyStateActive {
+			continue
+		}
+		k.State = KeyStateValid
+		if k.ExpireAt.IsZero() || k.ExpireAt.After(expireAt) {
+			k.ExpireAt = expireAt
+		}
+	}
+	m.keys[key.ID] = &ManagedKey{Key: key, State: KeyStateActive, ActivateAt: now}
+
+	return nil
+}
+
+// SetState changes the state of the key kid.
+func (m *KeyManager) SetState(kid string, state KeyState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[kid]
+	if !ok {
+		return ErrUnknownKid
+	}
+	key.State = state
+
+	return nil
+}
+
+// Retire stops the key kid from signing and verifying tokens.
+func (m *KeyManager) Retire(kid string) error {
+	return m.SetState(kid, KeyStateRetired)
+}
+
+// Prune removes the retired and expired keys.
+func (m *KeyManager) Prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for kid, key := range m.keys {
+		if !key.canVerify(now) {
+			delete(m.keys, kid)
+		}
+	}
+}
+
+// SigningKey returns the newest active key.
+func (m *KeyManager) SigningKey() (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.now()
+	var newest *ManagedKey
+	for _, key := range m.keys {
+		if !key.canSign(now) {
+			continue
+		}
+		if newest == nil || key.ActivateAt.After(newest.ActivateAt) {
+			newest = key
+		}
+	}
+	if newest == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return newest.Key, nil
+}
+
+// LookupKey returns the key kid if it is inside its verification window.
+func (m *KeyManager) LookupKey(kid string) (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.keys[kid]
+	if !ok || !key.canVerify(m.now()) {
+		return nil, ErrUnknownKid
+	}
+
+	return key.Key, nil
+}
+
+// Keys returns the keys inside their verification window, including the
+// active keys not activated yet, so they can be published in advance.
+func (m *KeyManager) Keys() []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := m.now()
+	keys := make([]*Key, 0, len(m.keys))
+	for _, key := range m.keys {
+		if key.canVerify(now) {
+			keys = append(keys, key.Key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys
+}
+
+// ManagedKeys returns a snapshot of all managed keys.
+func (m *KeyManager) ManagedKeys() []ManagedKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]ManagedKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActivateAt.Before(keys[j].ActivateAt) })
+
+	return keys
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyManagerRotate(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	m, err := NewKeyManager(nil, WithRotationClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := newTestKeys(t)
+	if err := m.Rotate(keys[1], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	token, err := NewKeySetIssuer(m, "iss", "aud", WithTimeFunc(clock)).Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Rotate(keys[2].Public(), time.Hour); !errors.Is(err, ErrVerifyOnlyKey) {
+		t.Errorf("rotate to a verify only key: got %v, want %v", err, ErrVerifyOnlyKey)
+	}
+	if key, err := m.SigningKey(); err != nil || key.ID != keys[1].ID {
+		t.Fatalf("signing key after a rejected rotation: got %v, %v", key, err)
+	}
+
+	if err := m.Rotate(keys[2], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := m.SigningKey(); err != nil || key.ID != keys[2].ID {
+		t.Fatalf("signing key after rotation: got %v, %v", key, err)
+	}
+	if _, err := ParseWithKeySet(token, m, WithClock(clock)); err != nil {
+		t.Errorf("verify inside the overlap: %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := m.LookupKey(keys[1].ID); !errors.Is(err, ErrUnknownKid) {
+		t.Errorf("lookup after the overlap: got %v, want %v", err, ErrUnknownKid)
+	}
+}
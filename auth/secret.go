@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Define the errors returned when a secret can not be used.
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrSecretExpired  = errors.New("secret is expired")
+	ErrSecretDisabled = errors.New("secret is disabled")
+	ErrSecretMismatch = errors.New("secretKey does not match")
+)
+
+// Define the lengths of generated secretId and secretKey.
+const (
+	SecretIDLength  = 36
+	SecretKeyLength = 32
+)
+
+// Secret is an API key, a secretId/secretKey pair owned by a user. The
+// secretKey is the HMAC key of the tokens it signs, so it is stored encrypted
+// and a dump of the table alone can not forge tokens.
+type Secret struct {
+	// May add TypeMeta in the future.
+	// metav1.TypeMeta `json:",inline"`
+
+	// Standard object's metadata.
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Owner is the user the secret belongs to.
+	Owner string `json:"owner" gorm:"column:owner;type:varchar(253);index;not null" validate:"required"`
+
+	// SecretID is the public identifier of the secret, the kid of the tokens it signs.
+	SecretID string `json:"secretID" gorm:"column:secretID;type:varchar(36);uniqueIndex;not null"`
+
+	// SecretKey is the secretKey, saving a secret fails unless the db uses the
+	// metav1.EncryptionPlugin.
+	SecretKey metav1.EncryptedString `json:"-" gorm:"column:secretKey;not null"`
+
+	// ExpiresAt is the time the secret expires, nil means never.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" gorm:"column:expiresAt"`
+
+	// Disabled secrets can not be used until enabled again.
+	Disabled bool `json:"disabled" gorm:"column:disabled"`
+
+	// Description describes the usage of the secret.
+	Description string `json:"description" gorm:"column:description;type:varchar(255)"`
+}
+
+// TableName maps to mysql table name.
+func (s *Secret) TableName() string {
+	return "secret"
+}
+
+// Usable returns an error if the secret is disabled or expired at now.
+func (s *Secret) Usable(now time.Time) error {
+	if s.Disabled {
+		return ErrSecretDisabled
+	}
+	if s.ExpiresAt != nil && !now.Before(*s.ExpiresAt) {
+		return ErrSecretExpired
+	}
+
+	return nil
+}
+
+// NewSecret generates a secret named name for owner and returns its secretKey
+// to hand out. The secretKey is not hashed, the SecretKeySet needs it as the
+// HMAC key of the tokens, so it is stored encrypted and returned again by
+// LookupKey. A zero ttl never expires.
+func NewSecret(name, owner, description string, ttl time.Duration) (*Secret, string, error) {
+	secretID, err := RandomID(SecretIDLength)
+	if err != nil {
+		return nil, "", err
+	}
+	secretKey, err := RandomID(SecretKeyLength)
+	if err != nil {
+		return nil, "", err
+	}
+	instanceID, err := RandomID(20)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret := &Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			InstanceID: "secret-" + instanceID,
+			Name:       name,
+		},
+		Owner:       owner,
+		SecretID:    secretID,
+		SecretKey:   metav1.EncryptedString(secretKey),
+		Description: description,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		secret.ExpiresAt = &expiresAt
+	}
+
+	return secret, secretKey, nil
+}
+
+// SecretStore persists secrets.
+type SecretStore interface {
+	// Create stores a new secret.
+	Create(ctx context.Context, secret *Secret) error
+
+	// Get returns the secret by its secretId, or ErrSecretNotFound.
+	Get(ctx context.Context, secretID string) (*Secret, error)
+
+	// List returns the secrets of owner.
+	List(ctx context.Context, owner string) ([]*Secret, error)
+
+	// Update updates the description, expiry and disabled state of a secret.
+	Update(ctx context.Context, secret *Secret) error
+
+	// Delete deletes the secret by its secretId.
+	Delete(ctx context.Context, secretID string) error
+}
+
+// SecretKeySet is a KeySet looking up the HMAC keys of tokens in a SecretStore.
+type SecretKeySet struct {
+	store SecretStore
+	now   func() time.Time
+}
+
+var _ KeySet = &SecretKeySet{}
+
+// NewSecretKeySet creates a SecretKeySet backed by store.
+func NewSecretKeySet(store SecretStore) *SecretKeySet {
+	return &SecretKeySet{store: store, now: time.Now}
+}
+
+// LookupKey returns the HMAC key of the usable secret kid.
+func (s *SecretKeySet) LookupKey(kid string) (*Key, error) {
+	secret, err := s.lookup(context.Background(), kid)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHMACKey(secret.SecretID, string(secret.SecretKey)), nil
+}
+
+// Authenticate checks a secretId/secretKey pair presented directly, e.g. as API key.
+func (s *SecretKeySet) Authenticate(ctx context.Context, secretID, secretKey string) (*Secret, error) {
+	secret, err := s.lookup(ctx, secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secretKey), []byte(secret.SecretKey)) != 1 {
+		return nil, ErrSecretMismatch
+	}
+
+	return secret, nil
+}
+
+func (s *SecretKeySet) lookup(ctx context.Context, secretID string) (*Secret, error) {
+	secret, err := s.store.Get(ctx, secretID)
+	if err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			return nil, ErrUnknownKid
+		}
+
+		return nil, err
+	}
+
+	if err := secret.Usable(s.now()); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
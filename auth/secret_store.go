@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormSecretStore is a SecretStore backed by gorm.
+type GormSecretStore struct {
+	db *gorm.DB
+}
+
+var _ SecretStore = &GormSecretStore{}
+
+// NewGormSecretStore creates a GormSecretStore using db.
+func NewGormSecretStore(db *gorm.DB) *GormSecretStore {
+	return &GormSecretStore{db: db}
+}
+
+// Create stores a new secret.
+func (s *GormSecretStore) Create(ctx context.Context, secret *Secret) error {
+	return s.db.WithContext(ctx).Create(secret).Error
+}
+
+// Get returns the secret by its secretId.
+func (s *GormSecretStore) Get(ctx context.Context, secretID string) (*Secret, error) {
+	secret := &Secret{}
+	err := s.db.WithContext(ctx).Where(s.db.Statement.Quote("secretID")+" = ?", secretID).First(secret).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSecretNotFound
+		}
+
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// List returns the secrets of owner.
+func (s *GormSecretStore) List(ctx context.Context, owner string) ([]*Secret, error) {
+	var secrets []*Secret
+	err := s.db.WithContext(ctx).Where(s.db.Statement.Quote("owner")+" = ?", owner).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: true}).Find(&secrets).Error
+
+	return secrets, err
+}
+
+// Update updates the description, expiry and disabled state of a secret.
+func (s *GormSecretStore) Update(ctx context.Context, secret *Secret) error {
+	return s.db.WithContext(ctx).Model(secret).
+		Where(s.db.Statement.Quote("secretID")+" = ?", secret.SecretID).
+		Select("description", "expiresAt", "disabled").
+		Updates(secret).Error
+}
+
+// Delete deletes the secret by its secretId permanently, a soft deleted secret
+// would keep its secretID and its encrypted secretKey. Secrets soft deleted
+// before can be removed with gormutil.Purge(ctx, db, &Secret{}, 0).
+func (s *GormSecretStore) Delete(ctx context.Context, secretID string) error {
+	return s.db.WithContext(ctx).Unscoped().
+		Where(s.db.Statement.Quote("secretID")+" = ?", secretID).Delete(&Secret{}).Error
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+func newTestSecretStore(t *testing.T) *GormSecretStore {
+	t.Helper()
+
+	provider, err := metav1.NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newTestDB(t, &Secret{})
+	if err := db.Use(metav1.NewEncryptionPlugin(metav1.NewEncryptor(provider))); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewGormSecretStore(db)
+}
+
+func TestSecretUsable(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	tests := []struct {
+		name   string
+		secret Secret
+		at     time.Time
+		want   error
+	}{
+		{"never expires", Secret{}, now, nil},
+		{"not expired yet", Secret{ExpiresAt: &expiresAt}, now, nil},
+		{"expired", Secret{ExpiresAt: &expiresAt}, expiresAt, ErrSecretExpired},
+		{"disabled", Secret{Disabled: true}, now, ErrSecretDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.secret.Usable(tt.at); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGormSecretStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSecretStore(t)
+
+	secret, secretKey, err := NewSecret("ci", "alice", "deploys", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := store.db.Model(&Secret{}).Where("id = ?", secret.ID).Pluck("secretKey", &stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !metav1.IsEncrypted(stored) {
+		t.Errorf("secretKey stored as %q, want it encrypted", stored)
+	}
+
+	got, err := store.Get(ctx, secret.SecretID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.SecretKey) != secretKey || got.Owner != "alice" {
+		t.Errorf("unexpected secret %+v", got)
+	}
+
+	got.Description, got.Disabled = "disabled", true
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := store.List(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 1 || !secrets[0].Disabled || secrets[0].Description != "disabled" ||
+		string(secrets[0].SecretKey) != secretKey {
+		t.Errorf("unexpected secrets %+v", secrets)
+	}
+
+	if err := store.Delete(ctx, secret.SecretID); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := store.db.Unscoped().Model(&Secret{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d secrets left after delete, %v", count, err)
+	}
+	if _, err := store.Get(ctx, secret.SecretID); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("got %v, want %v", err, ErrSecretNotFound)
+	}
+}
+
+func TestSecretKeySet(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSecretStore(t)
+
+	newSecret := func(ttl time.Duration, disabled bool) (*Secret, string) {
+		secret, secretKey, err := NewSecret("ci", "alice", "", ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret.Disabled = disabled
+		if err := store.Create(ctx, secret); err != nil {
+			t.Fatal(err)
+		}
+
+		return secret, secretKey
+	}
+	usable, secretKey := newSecret(time.Hour, false)
+	expired, _ := newSecret(time.Minute, false)
+	disabled, _ := newSecret(0, true)
+
+	keys := NewSecretKeySet(store)
+	keys.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+	token := Sign(usable.SecretID, secretKey, "iss", "aud")
+	claims, err := ParseWithKeySet(token, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.KeyID != usable.SecretID {
+		t.Errorf("got kid %q, want %q", claims.KeyID, usable.SecretID)
+	}
+
+	tests := []struct {
+		name string
+		kid  string
+		want error
+	}{
+		{"unknown kid", "unknown", ErrUnknownKid},
+		{"expired", expired.SecretID, ErrSecretExpired},
+		{"disabled", disabled.SecretID, ErrSecretDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.LookupKey(tt.kid); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := keys.Authenticate(ctx, usable.SecretID, secretKey); err != nil {
+		t.Errorf("authenticate: %v", err)
+	}
+	if _, err := keys.Authenticate(ctx, usable.SecretID, "wrong"); !errors.Is(err, ErrSecretMismatch) {
+		t.Errorf("got %v, want %v", err, ErrSecretMismatch)
+	}
+}
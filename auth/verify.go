@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/bxsec/gotool/json"
+)
+
+// Define the errors returned when a token fails verification.
+var (
+	ErrTokenMalformed          = errors.New("token is malformed")
+	ErrTokenExpired            = errors.New("token is expired")
+	ErrTokenNotValidYet        = errors.New("token is not valid yet")
+	ErrTokenUsedBeforeIssued   = errors.New("token used before issued")
+	ErrSignatureInvalid        = errors.New("token signature is invalid")
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrMissingKid              = errors.New("token header has no kid")
+	ErrUnknownKid              = errors.New("unknown kid")
+	ErrInvalidIssuer           = errors.New("token has invalid issuer")
+	ErrInvalidAudience         = errors.New("token has invalid audience")
+	ErrMissingExpiry           = errors.New("token has no exp claim")
+)
+
+// SecretFunc returns the secretKey for the given secretId, which is carried
+// in the `kid` header of the token. It should return ErrUnknownKid if the
+// secretId does not exist.
+type SecretFunc func(secretId string) (secretKey string, err error)
+
+// Claims is the typed claim set of a token issued by this package.
+type Claims struct {
+	jwt.RegisteredClaims
+
+	// KeyID is the `kid` header of the token the claims were parsed from.
+	KeyID string `json:"-"`
+
+	// Extra holds the claims which are not registered claims.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// registeredClaimNames lists the claims decoded into jwt.RegisteredClaims.
+var registeredClaimNames = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// Valid always succeeds, the time based claims are checked by the Verifier
+// which knows about the allowed clock skew.
+func (c *Claims) Valid() error {
+	return nil
+}
+
+// MarshalJSON encodes the registered and the extra claims as one object.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(c.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{}, len(c.Extra)+len(registeredClaimNames))
+	for k, v := range c.Extra {
+		m[k] = v
+	}
+	for _, name := range registeredClaimNames {
+		delete(m, name)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes the registered claims and keeps all other claims in Extra.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.RegisteredClaims); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for _, name := range registeredClaimNames {
+		delete(m, name)
+	}
+	if len(m) > 0 {
+		c.Extra = m
+	}
+
+	return nil
+}
+
+// Verifier verifies the tokens issued by Sign or an Issuer.
+type Verifier struct {
+	keys     KeySet
+	methods  []string
+	leeway   time.Duration
+	issuer   string
+	audience string
+	revoker  Revoker
+	now      func() time.Time
+
+	requireExpiry bool
+}
+
+// VerifyOption defines optional parameters for a Verifier.
+type VerifyOption func(*Verifier)
+
+// WithLeeway sets the allowed clock skew when checking exp, nbf and iat.
+func WithLeeway(leeway time.Duration) VerifyOption {
+	return func(v *Verifier) {
+		v.leeway = leeway
+	}
+}
+
+// WithRequireExpiry rejects the tokens without an exp claim, which are
+// otherwise valid forever.
+func WithRequireExpiry() VerifyOption {
+	return func(v *Verifier) {
+		v.requireExpiry = true
+	}
+}
+
+// WithIssuer sets the expected iss claim.
+func WithIssuer(iss string) VerifyOption {
+	return func(v *Verifier) {
+		v.issuer = iss
+	}
+}
+
+// WithAudience sets the expected aud claim.
+func WithAudience(aud string) VerifyOption {
+	return func(v *Verifier) {
+		v.audience = aud
+	}
+}
+
+// WithClock sets the function used to get the current time.
+func WithClock(now func() time.Time) VerifyOption {
+	return func(v *Verifier) {
+		v.now = now
+	}
+}
+
+// WithValidMethods sets the accepted signing algorithms.
+func WithValidMethods(methods ...string) VerifyOption {
+	return func(v *Verifier) {
+		v.methods = methods
+	}
+}
+
+// WithRevoker sets the Revoker consulted for every verified token.
+func WithRevoker(revoker Revoker) VerifyOption {
+	return func(v *Verifier) {
+		v.revoker = revoker
+	}
+}
+
+// NewVerifier creates a Verifier looking up the secretKey of a token with secretFunc.
+func NewVerifier(secretFunc SecretFunc, opts ...VerifyOption) *Verifier {
+	return NewKeySetVerifier(secretFunc, opts...)
+}
+
+// NewKeySetVerifier creates a Verifier looking up the key of a token in keys.
+func NewKeySetVerifier(keys KeySet, opts ...VerifyOption) *Verifier {
+	v := &Verifier{
+		keys: keys,
+		methods: []string{
+			"HS256", "HS384", "HS512",
+			"RS256", "RS384", "RS512",
+			"PS256", "PS384", "PS512",
+			"ES256", "ES384", "ES512",
+			"EdDSA",
+		},
+		now: time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+// Verify verifies the signature and the claims of tokenString and returns the claims.
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	return v.VerifyContext(context.Background(), tokenString)
+}
+
+// VerifyContext is like Verify, ctx is passed to the Revoker.
+func (v *Verifier) VerifyContext(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(v.methods), jwt.WithoutClaimsValidation())
+
+	token, err := parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if kid, ok := token.Header["kid"].(string); ok {
+		claims.KeyID = kid
+	}
+
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+
+	if v.revoker != nil {
+		revoked, err := v.revoker.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, ErrMissingKid
+	}
+
+	key, err := v.keys.LookupKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if !key.Allows(token.Method.Alg()) {
+		return nil, fmt.Errorf("%w: %s for kid %q", ErrUnexpectedSigningMethod, token.Method.Alg(), kid)
+	}
+
+	return key.PublicKey, nil
+}
+
+func (v *Verifier) validate(claims *Claims) error {
+	now := v.now()
+
+	if claims.ExpiresAt == nil && v.requireExpiry {
+		return ErrMissingExpiry
+	}
+	if claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Add(v.leeway)) {
+		return fmt.Errorf("%w: expired at %s", ErrTokenExpired, claims.ExpiresAt.Time)
+	}
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(claims.NotBefore.Time) {
+		return fmt.Errorf("%w: valid from %s", ErrTokenNotValidYet, claims.NotBefore.Time)
+	}
+	if claims.IssuedAt != nil && now.Add(v.leeway).Before(claims.IssuedAt.Time) {
+		return fmt.Errorf("%w: issued at %s", ErrTokenUsedBeforeIssued, claims.IssuedAt.Time)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, claims.Issuer)
+	}
+	if v.audience != "" && !claims.VerifyAudience(v.audience, true) {
+		return fmt.Errorf("%w: %q", ErrInvalidAudience, claims.Audience)
+	}
+
+	return nil
+}
+
+// convertError converts the errors of jwt parser into the errors of this package.
+func convertError(err error) error {
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	switch {
+	case ve.Inner != nil && ve.Errors&jwt.ValidationErrorUnverifiable != 0:
+		// errors returned by keyFunc
+		return ve.Inner
+	case ve.Errors&jwt.ValidationErrorMalformed != 0:
+		return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		if ve.Inner == nil {
+			return fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, err)
+		}
+
+		return ErrSignatureInvalid
+	default:
+		return err
+	}
+}
+
+// Parse verifies tokenString with the given options and returns its claims.
+func Parse(tokenString string, secretFunc SecretFunc, opts ...VerifyOption) (*Claims, error) {
+	return NewVerifier(secretFunc, opts...).Verify(tokenString)
+}
+
+// ParseWithKeySet verifies tokenString against the keys in keys and returns its claims.
+func ParseWithKeySet(tokenString string, keys KeySet, opts ...VerifyOption) (*Claims, error) {
+	return NewKeySetVerifier(keys, opts...).Verify(tokenString)
+}
+
+// Verify verifies a jwt token issued by Sign against the expected iss and aud,
+// the token must expire as the ones issued by Sign do.
+func Verify(tokenString string, secretFunc SecretFunc, iss, aud string) (*Claims, error) {
+	return Parse(tokenString, secretFunc, WithIssuer(iss), WithAudience(aud), WithRequireExpiry())
+}
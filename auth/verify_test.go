@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestSignVerify(t *testing.T) {
+	secretFunc := func(secretId string) (string, error) {
+		if secretId != "id" {
+			return "", ErrUnknownKid
+		}
+
+		return "key", nil
+	}
+
+	token := Sign("id", "key", "iss", "aud")
+	if _, err := Verify(token, secretFunc, "iss", "aud"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(Sign("other", "key", "iss", "aud"), secretFunc, "iss", "aud"); !errors.Is(err, ErrUnknownKid) {
+		t.Errorf("got %v, want %v", err, ErrUnknownKid)
+	}
+	if _, err := Verify(Sign("id", "wrong", "iss", "aud"), secretFunc, "iss", "aud"); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("got %v, want %v", err, ErrSignatureInvalid)
+	}
+	if _, err := Verify(token+"x", secretFunc, "iss", "aud"); err == nil {
+		t.Error("tampered token verified")
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	keys := NewStaticKeySet(NewHMACKey("id", "key"))
+	issuedAt := time.Now().Add(-time.Hour)
+	token, err := NewKeySetIssuer(keys, "iss", "aud", WithTimeFunc(func() time.Time { return issuedAt })).Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseWithKeySet(token, keys); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got %v, want %v", err, ErrTokenExpired)
+	}
+	if _, err := ParseWithKeySet(token, keys, WithClock(func() time.Time { return issuedAt })); err != nil {
+		t.Errorf("verify at issuing time: %v", err)
+	}
+}
+
+func TestVerifyAlgConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey("rsa", rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := NewStaticKeySet(key.Public())
+
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "admin"}}
+
+	// HS256 signed with the published RSA public key as secret
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWithKeySet(token, keys); !errors.Is(err, ErrUnexpectedSigningMethod) {
+		t.Errorf("HS256 with a RSA key: got %v, want %v", err, ErrUnexpectedSigningMethod)
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsigned.Header["kid"] = "rsa"
+	token, err = unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWithKeySet(token, keys); err == nil {
+		t.Error("unsigned token verified")
+	}
+
+	if _, err := ParseWithKeySet(Sign("rsa", string(publicPEM), "", ""), keys); !errors.Is(err, ErrUnexpectedSigningMethod) {
+		t.Errorf("Sign with a RSA key: got %v, want %v", err, ErrUnexpectedSigningMethod)
+	}
+}
+
+func TestVerifyRequireExpiry(t *testing.T) {
+	keys := NewStaticKeySet(NewHMACKey("id", "key"))
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "iss", Audience: jwt.ClaimStrings{"aud"}}}
+	unexpiring := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unexpiring.Header["kid"] = "id"
+	token, err := unexpiring.SignedString([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseWithKeySet(token, keys); err != nil {
+		t.Errorf("verify without exp: %v", err)
+	}
+	if _, err := ParseWithKeySet(token, keys, WithRequireExpiry()); !errors.Is(err, ErrMissingExpiry) {
+		t.Errorf("got %v, want %v", err, ErrMissingExpiry)
+	}
+	secretFunc := func(string) (string, error) { return "key", nil }
+	if _, err := Verify(token, secretFunc, "iss", "aud"); !errors.Is(err, ErrMissingExpiry) {
+		t.Errorf("Verify: got %v, want %v", err, ErrMissingExpiry)
+	}
+}
@@ -0,0 +1,247 @@
+// Package authorizer decides whether a subject may perform an action on a
+// resource, by evaluating role and attribute based policies.
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bxsec/gotool/auth"
+	metav1 "github.com/bxsec/gotool/meta/v1"
+	"github.com/bxsec/gotool/util/net"
+)
+
+// ErrDenied is returned when a request is not allowed.
+var ErrDenied = errors.New("permission denied")
+
+// Define the attributes always available to conditions.
+const (
+	AttributeSubject  = "subject"
+	AttributeAction   = "action"
+	AttributeResource = "resource"
+	AttributeIP       = "ip"
+	AttributeMethod   = "method"
+	AttributePath     = "path"
+
+	// ClaimsPrefix prefixes the claims of the token authenticated by auth.Middleware,
+	// e.g. "claims.role" or "claims.iss".
+	ClaimsPrefix = "claims."
+)
+
+// RoleFunc returns the roles of subject.
+type RoleFunc func(ctx context.Context, subject string) ([]string, error)
+
+// RolesFromClaims returns the roles listed in the claim name of the token in ctx.
+func RolesFromClaims(name string) RoleFunc {
+	return func(ctx context.Context, subject string) ([]string, error) {
+		if auth.SubjectFromContext(ctx) != subject {
+			return nil, nil
+		}
+		roles, _ := auth.ClaimFromContext(ctx, name)
+
+		return toStrings(roles), nil
+	}
+}
+
+// Authorizer evaluates policies, a request is allowed if a policy allows it
+// and no policy denies it.
+type Authorizer struct {
+	mu             sync.RWMutex
+	policies       []*Policy
+	roleFunc       RoleFunc
+	proxies        []string
+	trustedProxies net.TrustedProxies
+}
+
+// Option defines optional parameters for an Authorizer.
+type Option func(*Authorizer)
+
+// WithRoleFunc sets how the roles of a subject are found, the default is the "roles" claim.
+func WithRoleFunc(fn RoleFunc) Option {
+	return func(a *Authorizer) {
+		a.roleFunc = fn
+	}
+}
+
+// WithTrustedProxies sets the CIDR ranges of the reverse proxies whose
+// X-Forwarded-For header is trusted for the ip attribute of AuthorizeFunc.
+func WithTrustedProxies(cidrs ...string) Option {
+	return func(a *Authorizer) {
+		a.proxies = cidrs
+	}
+}
+
+// New creates an Authorizer evaluating policies.
+func New(policies []*Policy, opts ...Option) (*Authorizer, error) {
+	a := &Authorizer{roleFunc: RolesFromClaims("roles")}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	var err error
+	if a.trustedProxies, err = net.ParseTrustedProxies(a.proxies...); err != nil {
+		return nil, err
+	}
+
+	if err := a.SetPolicies(policies); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// SetPolicies validates and replaces the policies, e.g. after they are reloaded.
+func (a *Authorizer) SetPolicies(policies []*Policy) error {
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policies = policies
+
+	return nil
+}
+
+// Policies returns the policies evaluated by the Authorizer.
+func (a *Authorizer) Policies() []*Policy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return append([]*Policy(nil), a.policies...)
+}
+
+// Authorize returns nil if subject may perform action on resource. Conditions
+// are evaluated against the attributes carried by ctx.
+func (a *Authorizer) Authorize(ctx context.Context, subject, action, resource string) error {
+	return a.AuthorizeWithOptions(ctx, subject, action, resource, metav1.AuthorizeOptions{})
+}
+
+// AuthorizeWithOptions is like Authorize, with extra attributes in opts.
+func (a *Authorizer) AuthorizeWithOptions(ctx context.Context, subject, action, resource string,
+	opts metav1.AuthorizeOptions) error {
+	var roles []string
+	if a.roleFunc != nil {
+		var err error
+		if roles, err = a.roleFunc(ctx, subject); err != nil {
+			return fmt.Errorf("get roles of %s: %w", subject, err)
+		}
+	}
+
+	attrs := func(key string) (interface{}, bool) {
+		switch key {
+		case AttributeSubject:
+			return subject, true
+		case AttributeAction:
+			return action, true
+		case AttributeResource:
+			return resource, true
+		}
+		if v, ok := opts.Attributes[key]; ok {
+			return v, true
+		}
+
+		return attributeFromContext(ctx, key)
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var allowed bool
+	for _, p := range a.policies {
+		if !p.matches(subject, roles, action, resource, attrs) {
+			continue
+		}
+		if p.Effect == Deny {
+			return fmt.Errorf("%w: %s %s denied by policy %q", ErrDenied, action, resource, p.ID)
+		}
+		allowed = true
+	}
+	if !allowed {
+		return fmt.Errorf("%w: no policy allows %s to %s %s", ErrDenied, subject, action, resource)
+	}
+
+	return nil
+}
+
+// AuthorizeFunc returns a function for auth.WithAuthorizeFunc authorizing the
+// subject of the token, resourceFunc maps a request to its action and resource.
+func (a *Authorizer) AuthorizeFunc(
+	resourceFunc func(r *http.Request) (action, resource string),
+) func(r *http.Request, claims *auth.Claims) error {
+	return func(r *http.Request, claims *auth.Claims) error {
+		ctx := auth.NewContext(NewRequestContext(r, a.trustedProxies), claims)
+		action, resource := resourceFunc(r)
+
+		return a.Authorize(ctx, claims.Subject, action, resource)
+	}
+}
+
+type attributeFunc func(key string) (interface{}, bool)
+
+type attributesContextKey struct{}
+
+// NewContext returns a new Context that carries attrs, on top of the attributes ctx already carries.
+func NewContext(ctx context.Context, attrs map[string]interface{}) context.Context {
+	merged := make(map[string]interface{}, len(attrs))
+	if parent, ok := ctx.Value(attributesContextKey{}).(map[string]interface{}); ok {
+		for k, v := range parent {
+			merged[k] = v
+		}
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, attributesContextKey{}, merged)
+}
+
+// NewRequestContext returns the context of r carrying the ip, method and path
+// attributes. The ip is the peer address of r, unless the peer is one of the
+// trustedProxies, see net.TrustedProxies.ClientIP.
+func NewRequestContext(r *http.Request, trustedProxies net.TrustedProxies) context.Context {
+	return NewContext(r.Context(), map[string]interface{}{
+		AttributeIP:     trustedProxies.ClientIP(r),
+		AttributeMethod: r.Method,
+		AttributePath:   r.URL.Path,
+	})
+}
+
+func attributeFromContext(ctx context.Context, key string) (interface{}, bool) {
+	if attrs, ok := ctx.Value(attributesContextKey{}).(map[string]interface{}); ok {
+		if v, ok := attrs[key]; ok {
+			return v, true
+		}
+	}
+
+	name := strings.TrimPrefix(key, ClaimsPrefix)
+	if name == key {
+		return nil, false
+	}
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	switch name {
+	case "iss":
+		return claims.Issuer, claims.Issuer != ""
+	case "sub":
+		return claims.Subject, claims.Subject != ""
+	case "aud":
+		return []string(claims.Audience), len(claims.Audience) > 0
+	case "jti":
+		return claims.ID, claims.ID != ""
+	case "kid":
+		return claims.KeyID, claims.KeyID != ""
+	}
+	v, ok := claims.Extra[name]
+
+	return v, ok
+}
@@ -0,0 +1,120 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bxsec/gotool/auth"
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+func newTestAuthorizer(t *testing.T, opts ...Option) *Authorizer {
+	t.Helper()
+
+	a, err := New([]*Policy{
+		{ID: "allow", Subjects: []string{"*"}, Actions: []string{"*"}, Resources: []string{"*"}, Effect: Allow},
+		{
+			ID: "internal-only", Subjects: []string{"*"}, Actions: []string{"delete"}, Resources: []string{"*"},
+			Effect:     Deny,
+			Conditions: []Condition{{Key: AttributeIP, Operator: OpNotCIDR, Values: []string{"10.0.0.0/8"}}},
+		},
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func TestDenyFailsClosed(t *testing.T) {
+	a := newTestAuthorizer(t)
+
+	if err := a.Authorize(context.Background(), "alice", "delete", "users"); !errors.Is(err, ErrDenied) {
+		t.Errorf("without ip: got %v, want %v", err, ErrDenied)
+	}
+	opts := metav1.AuthorizeOptions{Attributes: map[string]interface{}{AttributeIP: "not an ip"}}
+	if err := a.AuthorizeWithOptions(context.Background(), "alice", "delete", "users", opts); !errors.Is(err, ErrDenied) {
+		t.Errorf("with an invalid ip: got %v, want %v", err, ErrDenied)
+	}
+	opts.Attributes[AttributeIP] = "10.1.1.1"
+	if err := a.AuthorizeWithOptions(context.Background(), "alice", "delete", "users", opts); err != nil {
+		t.Errorf("with an internal ip: %v", err)
+	}
+}
+
+func TestAllowRequiresAttributes(t *testing.T) {
+	a, err := New([]*Policy{{
+		ID: "admins", Subjects: []string{"*"}, Actions: []string{"*"}, Resources: []string{"*"}, Effect: Allow,
+		Conditions: []Condition{{Key: "claims.admin", Operator: OpNotEquals, Values: []string{"false"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Authorize(context.Background(), "alice", "get", "users"); !errors.Is(err, ErrDenied) {
+		t.Errorf("got %v, want %v", err, ErrDenied)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	a := newTestAuthorizer(t, WithTrustedProxies("192.168.0.0/16"))
+	check := a.AuthorizeFunc(func(r *http.Request) (string, string) { return "delete", "users" })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		allowed    bool
+	}{
+		{"internal peer", "10.1.1.1:1234", nil, true},
+		{"spoofed headers", "8.8.8.8:1234", map[string]string{
+			"X-Client-IP": "10.1.1.1", "X-Real-IP": "10.1.1.1", "X-Forwarded-For": "10.1.1.1",
+		}, false},
+		{"internal client behind proxy", "192.168.1.1:1234", map[string]string{"X-Forwarded-For": "10.1.1.1"}, true},
+		{"spoofed client behind proxy", "192.168.1.1:1234", map[string]string{
+			"X-Forwarded-For": "10.1.1.1, 8.8.8.8",
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/users", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if err := check(r, &auth.Claims{}); (err == nil) != tt.allowed {
+				t.Errorf("got %v, want allowed %v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestValidateKeepsConditions(t *testing.T) {
+	conditions := []Condition{{Key: AttributeIP, Operator: OpCIDR, Values: []string{"10.0.0.0/8"}}}
+	p := &Policy{
+		ID: "internal", Subjects: []string{"*"}, Actions: []string{"*"}, Resources: []string{"*"}, Effect: Allow,
+		Conditions: conditions,
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if conditions[0].nets != nil {
+		t.Error("Validate changed the conditions of the caller")
+	}
+	if len(p.Conditions[0].nets) != 1 {
+		t.Errorf("got %d networks, want 1", len(p.Conditions[0].nets))
+	}
+
+	p.Conditions = append(p.Conditions, Condition{Key: AttributeIP, Operator: OpCIDR, Values: []string{"invalid"}})
+	validated := p.Conditions
+	if err := p.Validate(); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPolicy)
+	}
+	if &p.Conditions[0] != &validated[0] {
+		t.Error("an invalid policy replaced its conditions")
+	}
+}
@@ -0,0 +1,301 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/bxsec/gotool/json"
+)
+
+// Effect is the outcome of a matching policy.
+type Effect string
+
+// Define the effects of a policy, deny takes precedence over allow.
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Define the operators of a condition.
+const (
+	// OpEquals matches if the attribute equals one of the values.
+	OpEquals = "equals"
+	// OpNotEquals matches if the attribute equals none of the values.
+	OpNotEquals = "notEquals"
+	// OpLike matches if the attribute matches one of the wildcard values.
+	OpLike = "like"
+	// OpCIDR matches if the attribute is an IP in one of the CIDR values.
+	OpCIDR = "cidr"
+	// OpNotCIDR matches if the attribute is an IP in none of the CIDR values.
+	OpNotCIDR = "notCidr"
+)
+
+// ErrInvalidPolicy is returned when a policy can not be evaluated.
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Condition restricts a policy to requests whose attribute Key satisfies the
+// operator with Values. A condition which can not be evaluated, because the
+// attribute is missing or is not an IP for a cidr operator, never satisfies
+// an allow policy and always satisfies a deny policy, so denials fail closed.
+type Condition struct {
+	// Key is the attribute name, e.g. "ip" or "claims.role".
+	Key string `json:"key"`
+
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+
+	nets []*net.IPNet
+}
+
+// Policy allows or denies its subjects to perform its actions on its
+// resources. Subjects, actions and resources may contain the wildcard `*`
+// matching any sequence of characters. A subject `role:<name>` matches the
+// subjects having the role.
+type Policy struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description,omitempty"`
+	Subjects    []string    `json:"subjects"`
+	Actions     []string    `json:"actions"`
+	Resources   []string    `json:"resources"`
+	Effect      Effect      `json:"effect"`
+	Conditions  []Condition `json:"conditions,omitempty"`
+}
+
+// Validate checks the policy and prepares its conditions for evaluation. The
+// conditions are prepared in a copy, so the policies sharing their slice are
+// not modified while they are evaluated.
+func (p *Policy) Validate() error {
+	if p.Effect != Allow && p.Effect != Deny {
+		return fmt.Errorf("%w %q: effect must be %q or %q", ErrInvalidPolicy, p.ID, Allow, Deny)
+	}
+	if len(p.Subjects) == 0 || len(p.Actions) == 0 || len(p.Resources) == 0 {
+		return fmt.Errorf("%w %q: subjects, actions and resources are required", ErrInvalidPolicy, p.ID)
+	}
+
+	conditions := append([]Condition(nil), p.Conditions...)
+	for i := range conditions {
+		c := &conditions[i]
+		if c.Key == "" {
+			return fmt.Errorf("%w %q: condition key is required", ErrInvalidPolicy, p.ID)
+		}
+
+		switch c.Operator {
+		case OpEquals, OpNotEquals, OpLike:
+		case OpCIDR, OpNotCIDR:
+			c.nets = nil
+			for _, value := range c.Values {
+				_, ipNet, err := net.ParseCIDR(value)
+				if err != nil {
+					return fmt.Errorf("%w %q: %v", ErrInvalidPolicy, p.ID, err)
+				}
+				c.nets = append(c.nets, ipNet)
+			}
+		default:
+			return fmt.Errorf("%w %q: unknown condition operator %q", ErrInvalidPolicy, p.ID, c.Operator)
+		}
+	}
+	p.Conditions = conditions
+
+	return nil
+}
+
+// LoadPolicies decodes and validates a JSON array of policies.
+func LoadPolicies(r io.Reader) ([]*Policy, error) {
+	var policies []*Policy
+	if err := json.NewDecoder(r).Decode(&policies); err != nil {
+		return nil, fmt.Errorf("decode policies: %w", err)
+	}
+
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return policies, nil
+}
+
+// LoadPoliciesFile loads the policies of a JSON file.
+func LoadPoliciesFile(file string) ([]*Policy, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadPolicies(f)
+}
+
+// matches reports whether the request matches the policy, roles are the roles of subject.
+func (p *Policy) matches(subject string, roles []string, action, resource string, attrs attributeFunc) bool {
+	if !matchSubject(p.Subjects, subject, roles) || !matchAny(p.Actions, action) || !matchAny(p.Resources, resource) {
+		return false
+	}
+
+	for i := range p.Conditions {
+		matched, ok := p.Conditions[i].matches(attrs)
+		if !ok {
+			matched = p.Effect == Deny
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchSubject(patterns []string, subject string, roles []string) bool {
+	for _, pattern := range patterns {
+		if role := strings.TrimPrefix(pattern, "role:"); role != pattern {
+			for _, r := range roles {
+				if match(role, r) {
+					return true
+				}
+			}
+
+			continue
+		}
+		if match(pattern, subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAny reports whether s matches one of the patterns.
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match reports whether s matches pattern, in which `*` matches any sequence of characters.
+func match(pattern, s string) bool {
+	star, next := -1, 0
+	i, j := 0, 0
+	for j < len(s) {
+		switch {
+		case i < len(pattern) && pattern[i] == '*':
+			star, next = i, j
+			i++
+		case i < len(pattern) && pattern[i] == s[j]:
+			i++
+			j++
+		case star >= 0:
+			// let the last star absorb one more character
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+	for i < len(pattern) && pattern[i] == '*' {
+		i++
+	}
+
+	return i == len(pattern)
+}
+
+// matches reports whether the condition is satisfied, ok is false if it can
+// not be evaluated.
+func (c *Condition) matches(attrs attributeFunc) (matched, ok bool) {
+	value, ok := attrs(c.Key)
+	if !ok {
+		return false, false
+	}
+	values := toStrings(value)
+	if len(values) == 0 {
+		return false, false
+	}
+
+	switch c.Operator {
+	case OpEquals:
+		return anyOf(values, func(v string) bool { return containsString(c.Values, v) }), true
+	case OpNotEquals:
+		return !anyOf(values, func(v string) bool { return containsString(c.Values, v) }), true
+	case OpLike:
+		return anyOf(values, func(v string) bool {
+			for _, pattern := range c.Values {
+				if match(pattern, v) {
+					return true
+				}
+			}
+
+			return false
+		}), true
+	case OpCIDR, OpNotCIDR:
+		in := false
+		for _, v := range values {
+			ip := net.ParseIP(strings.TrimSpace(v))
+			if ip == nil {
+				return false, false
+			}
+			in = in || c.inNets(ip)
+		}
+
+		return in == (c.Operator == OpCIDR), true
+	}
+
+	return false, false
+}
+
+func (c *Condition) inNets(ip net.IP) bool {
+	for _, ipNet := range c.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toStrings converts an attribute, e.g. a claim decoded from JSON, to strings.
+func toStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			values = append(values, fmt.Sprint(e))
+		}
+
+		return values
+	case nil:
+		return nil
+	}
+
+	return []string{fmt.Sprint(value)}
+}
+
+func anyOf(values []string, fn func(string) bool) bool {
+	for _, v := range values {
+		if fn(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package fields
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is returned when a selector can not be parsed, Pos is the byte
+// offset of the error in Input.
+type ParseError struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid field selector %q at position %d: %s", e.Input, e.Pos, e.Msg)
+}
+
+// valueEscaper escapes the characters with a meaning in selectors.
+var valueEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`, `!`, `\!`)
+
+// EscapeValue escapes the characters of value which have a meaning in a selector.
+func EscapeValue(value string) string {
+	return valueEscaper.Replace(value)
+}
+
+// Parse parses a selector such as "metadata.name=foo,status!=disabled". The
+// operators are `=`, `==` and `!=`, and a backslash escapes `\`, `,`, `=` and
+// `!` in values. An empty selector matches everything.
+func Parse(selector string) (Selector, error) {
+	if strings.TrimSpace(selector) == "" {
+		return Everything(), nil
+	}
+
+	var requirements []Requirement
+	for pos := 0; ; {
+		r, next, err := parseRequirement(selector, pos)
+		if err != nil {
+			return Selector{}, err
+		}
+		requirements = append(requirements, r)
+		if next >= len(selector) {
+			break
+		}
+		// skip the comma
+		pos = next + 1
+	}
+
+	return Selector{Requirements: requirements}, nil
+}
+
+// parseRequirement parses the requirement starting at pos, and returns the
+// position of the comma ending it or the end of selector.
+func parseRequirement(selector string, pos int) (Requirement, int, error) {
+	errorf := func(pos int, format string, args ...interface{}) error {
+		return &ParseError{Input: selector, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	i := pos
+	for i < len(selector) && !strings.ContainsRune("=!,", rune(selector[i])) {
+		i++
+	}
+	field := strings.TrimSpace(selector[pos:i])
+	if field == "" {
+		return Requirement{}, 0, errorf(pos, "expected field name")
+	}
+
+	var op Operator
+	switch {
+	case strings.HasPrefix(selector[i:], "!="):
+		op, i = NotEquals, i+2
+	case strings.HasPrefix(selector[i:], "=="):
+		op, i = Equals, i+2
+	case strings.HasPrefix(selector[i:], "="):
+		op, i = Equals, i+1
+	default:
+		return Requirement{}, 0, errorf(i, "expected operator '=', '==' or '!=' after field %q", field)
+	}
+
+	var value strings.Builder
+	for ; i < len(selector) && selector[i] != ','; i++ {
+		c := selector[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(selector) || !strings.ContainsRune(`\,=!`, rune(selector[i+1])) {
+				return Requirement{}, 0, errorf(i, "invalid escape sequence")
+			}
+			i++
+			value.WriteByte(selector[i])
+		case '=', '!':
+			return Requirement{}, 0, errorf(i, "unescaped %q in value", c)
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return Requirement{Field: field, Operator: op, Value: strings.TrimSpace(value.String())}, i, nil
+}
@@ -0,0 +1,93 @@
+package fields
+
+import (
+	"strings"
+
+	"github.com/bxsec/gotool/json"
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Project trims the JSON representation of v to fields, dotted JSON paths
+// such as "metadata.name". An array is trimmed element by element, and so are
+// the items of a metav1.ListInterface such as a paginate.List, whose list
+// metadata is kept. v is returned as is if fields is empty.
+func Project(v interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	paths := make([][]string, 0, len(fields))
+	for _, field := range fields {
+		paths = append(paths, strings.Split(field, "."))
+	}
+
+	if items, ok := decoded.([]interface{}); ok {
+		return projectItems(items, paths), nil
+	}
+	if _, ok := v.(metav1.ListInterface); ok {
+		if list, ok := decoded.(map[string]interface{}); ok {
+			if items, ok := list["items"].([]interface{}); ok {
+				list["items"] = projectItems(items, paths)
+
+				return list, nil
+			}
+		}
+	}
+
+	return project(decoded, paths), nil
+}
+
+func projectItems(items []interface{}, paths [][]string) []interface{} {
+	for i, item := range items {
+		items[i] = project(item, paths)
+	}
+
+	return items
+}
+
+// project keeps the paths of an object, other values are kept as is.
+func project(v interface{}, paths [][]string) interface{} {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+
+	out := make(map[string]interface{})
+	for _, path := range paths {
+		copyPath(obj, out, path)
+	}
+
+	return out
+}
+
+func copyPath(src, dst map[string]interface{}, path []string) {
+	value, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		dst[path[0]] = value
+
+		return
+	}
+
+	child, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	out, ok := dst[path[0]].(map[string]interface{})
+	if !ok {
+		out = make(map[string]interface{})
+		dst[path[0]] = out
+	}
+	copyPath(child, out, path[1:])
+}
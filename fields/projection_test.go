@@ -0,0 +1,47 @@
+package fields
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+type testItem struct {
+	metav1.ObjectMeta `json:"metadata"`
+
+	Status string `json:"status"`
+}
+
+type testList struct {
+	metav1.ListMeta `json:",inline"`
+
+	Items []testItem `json:"items"`
+}
+
+func TestProjectList(t *testing.T) {
+	list := &testList{
+		ListMeta: metav1.ListMeta{TotalCount: 1},
+		Items:    []testItem{{ObjectMeta: metav1.ObjectMeta{Name: "foo", InstanceID: "i-1"}, Status: "ok"}},
+	}
+
+	got, err := Project(list, []string{"metadata.name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"totalCount": float64(1),
+		"items":      []interface{}{map[string]interface{}{"metadata": map[string]interface{}{"name": "foo"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Project() = %v, want %v", got, want)
+	}
+}
+
+func TestListOptionsScopeSortWithContinue(t *testing.T) {
+	opts := &metav1.ListOptions{SortBy: "-metadata.name", Continue: "token"}
+	if _, err := ListOptionsScope(opts, FieldMap{"metadata.name": "name"}); !errors.Is(err, ErrSortWithContinue) {
+		t.Fatalf("ListOptionsScope() = %v, want ErrSortWithContinue", err)
+	}
+}
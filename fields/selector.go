@@ -0,0 +1,147 @@
+// Package fields parses field selectors such as "name=foo,status!=disabled"
+// and translates them into gorm queries over a whitelist of fields.
+package fields
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Define the errors returned when validating list options.
+var (
+	// ErrFieldNotSelectable is returned when a selector uses a field which is not whitelisted.
+	ErrFieldNotSelectable = errors.New("field is not selectable")
+
+	// ErrSortWithContinue is returned when sortBy is set with a continue token,
+	// keyset pagination has its own order.
+	ErrSortWithContinue = errors.New("sortBy can not be used with continue")
+)
+
+// Operator is the operator of a Requirement.
+type Operator string
+
+// Define the operators of a requirement, `==` is parsed as Equals.
+const (
+	Equals    Operator = "="
+	NotEquals Operator = "!="
+)
+
+// Requirement is a condition on a single field.
+type Requirement struct {
+	Field    string
+	Operator Operator
+	Value    string
+}
+
+// String returns the requirement with the special characters of the value escaped.
+func (r Requirement) String() string {
+	return r.Field + string(r.Operator) + EscapeValue(r.Value)
+}
+
+// Selector is a parsed field selector, the conjunction of its requirements.
+type Selector struct {
+	Requirements []Requirement
+}
+
+// Everything returns a selector matching all objects.
+func Everything() Selector {
+	return Selector{}
+}
+
+// Empty reports whether the selector matches everything.
+func (s Selector) Empty() bool {
+	return len(s.Requirements) == 0
+}
+
+// Matches reports whether the field values satisfy all the requirements, a missing field is empty.
+func (s Selector) Matches(fields map[string]string) bool {
+	for _, r := range s.Requirements {
+		if (fields[r.Field] == r.Value) != (r.Operator == Equals) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the selector in canonical form.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s.Requirements))
+	for _, r := range s.Requirements {
+		terms = append(terms, r.String())
+	}
+
+	return strings.Join(terms, ",")
+}
+
+// FieldMap whitelists the selectable fields of a resource, it maps the field
+// names used in selectors to their database columns, e.g. "metadata.name" to "name".
+type FieldMap map[string]string
+
+// Fields returns the selectable field names, sorted.
+func (m FieldMap) Fields() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Validate returns an error wrapping ErrFieldNotSelectable if a requirement
+// uses a field missing from fieldMap.
+func (s Selector) Validate(fieldMap FieldMap) error {
+	for _, r := range s.Requirements {
+		if _, err := fieldMap.column(r.Field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Scope returns a gorm scope restricting a query to the rows matching the
+// selector, the values are passed as query parameters.
+func (s Selector) Scope(fieldMap FieldMap) (func(*gorm.DB) *gorm.DB, error) {
+	if err := s.Validate(fieldMap); err != nil {
+		return nil, err
+	}
+
+	exprs := make([]clause.Expression, 0, len(s.Requirements))
+	for _, r := range s.Requirements {
+		column := clause.Column{Name: fieldMap[r.Field]}
+		if r.Operator == Equals {
+			exprs = append(exprs, clause.Eq{Column: column, Value: r.Value})
+		} else {
+			exprs = append(exprs, clause.Neq{Column: column, Value: r.Value})
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if len(exprs) == 0 {
+			return db
+		}
+
+		return db.Where(clause.And(exprs...))
+	}, nil
+}
+
+// ScopeFromListOptions parses the FieldSelector of opts and returns its Scope.
+func ScopeFromListOptions(opts *metav1.ListOptions, fieldMap FieldMap) (func(*gorm.DB) *gorm.DB, error) {
+	selector := Everything()
+	if opts != nil {
+		var err error
+		if selector, err = Parse(opts.FieldSelector); err != nil {
+			return nil, err
+		}
+	}
+
+	return selector.Scope(fieldMap)
+}
@@ -0,0 +1,147 @@
+package fields
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []Requirement
+		str      string
+	}{
+		{"", nil, ""},
+		{"  ", nil, ""},
+		{"name=foo", []Requirement{{"name", Equals, "foo"}}, "name=foo"},
+		{"name==foo", []Requirement{{"name", Equals, "foo"}}, "name=foo"},
+		{" name != foo ", []Requirement{{"name", NotEquals, "foo"}}, "name!=foo"},
+		{"name=", []Requirement{{"name", Equals, ""}}, "name="},
+		{
+			`name=a\,b\=c\!d\\e,status!=disabled`,
+			[]Requirement{{"name", Equals, `a,b=c!d\e`}, {"status", NotEquals, "disabled"}},
+			`name=a\,b\=c\!d\\e,status!=disabled`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s.Requirements, tt.want) {
+				t.Errorf("got requirements %+v, want %+v", s.Requirements, tt.want)
+			}
+			if s.String() != tt.str {
+				t.Errorf("got %q, want %q", s.String(), tt.str)
+			}
+
+			again, err := Parse(s.String())
+			if err != nil || !reflect.DeepEqual(again, s) {
+				t.Errorf("round trip of %q: got %+v, %v", s.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		selector string
+		pos      int
+	}{
+		{"name", 4},
+		{"=foo", 0},
+		{"name=foo,", 9},
+		{",name=foo", 0},
+		{"name=foo,status", 15},
+		{"name=a=b", 6},
+		{"name=a!b", 6},
+		{"name!foo", 4},
+		{`name=a\b`, 6},
+		{`name=a\`, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			_, err := Parse(tt.selector)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got %v, want a ParseError", err)
+			}
+			if parseErr.Pos != tt.pos || parseErr.Input != tt.selector {
+				t.Errorf("got error at %d of %q, want %d: %v", parseErr.Pos, parseErr.Input, tt.pos, err)
+			}
+		})
+	}
+}
+
+type scopeItem struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Name   string `gorm:"column:name"`
+	Status string `gorm:"column:status"`
+	Secret string `gorm:"column:secret"`
+}
+
+func TestScope(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection opens another in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&scopeItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create([]*scopeItem{
+		{Name: "a,b", Status: "enabled", Secret: "s1"},
+		{Name: "c", Status: "disabled", Secret: "s2"},
+		{Name: "d", Status: "", Secret: "s3"},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	fieldMap := FieldMap{"metadata.name": "name", "status": "status"}
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{"", []string{"a,b", "c", "d"}},
+		{`metadata.name=a\,b`, []string{"a,b"}},
+		{"status!=disabled", []string{"a,b", "d"}},
+		{"status=", []string{"d"}},
+		{"status!=disabled,metadata.name=d", []string{"d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			scope, err := ScopeFromListOptions(&metav1.ListOptions{FieldSelector: tt.selector}, fieldMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			if err := db.Model(&scopeItem{}).Scopes(scope).Order("id").Pluck("name", &names).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	for _, selector := range []string{"secret=s1", "name=c", "metadata.name=c,id!=1"} {
+		_, err := ScopeFromListOptions(&metav1.ListOptions{FieldSelector: selector}, fieldMap)
+		if !errors.Is(err, ErrFieldNotSelectable) {
+			t.Errorf("%s: got %v, want %v", selector, err, ErrFieldNotSelectable)
+		}
+	}
+}
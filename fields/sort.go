@@ -0,0 +1,215 @@
+package fields
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// SortField is a field of a sortBy parameter.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// String returns the field prefixed with '-' if it is sorted in descending order.
+func (f SortField) String() string {
+	if f.Desc {
+		return "-" + f.Field
+	}
+
+	return f.Field
+}
+
+// ParseSort parses a sortBy parameter such as "-createdAt,name": comma
+// separated fields, sorted in descending order if prefixed with '-' and in
+// ascending order otherwise, or if prefixed with '+'.
+func ParseSort(sortBy string) ([]SortField, error) {
+	var sortFields []SortField
+	for _, term := range splitList(sortBy) {
+		f := SortField{Field: term}
+		switch term[0] {
+		case '-':
+			f = SortField{Field: term[1:], Desc: true}
+		case '+':
+			f = SortField{Field: term[1:]}
+		}
+		if f.Field == "" {
+			return nil, fmt.Errorf("invalid sortBy %q: empty field name", sortBy)
+		}
+		sortFields = append(sortFields, f)
+	}
+
+	return sortFields, nil
+}
+
+// SortScope returns a gorm scope ordering a query by the fields of sortBy,
+// which must be in fieldMap.
+func SortScope(sortBy string, fieldMap FieldMap) (func(*gorm.DB) *gorm.DB, error) {
+	sortFields, err := ParseSort(sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]clause.OrderByColumn, 0, len(sortFields))
+	for _, f := range sortFields {
+		column, err := fieldMap.column(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: f.Desc})
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		// ordering a count fails on PostgreSQL
+		if counting(db) {
+			return db
+		}
+		for _, column := range columns {
+			db = db.Order(column)
+		}
+
+		return db
+	}, nil
+}
+
+// ParseFields splits a fields parameter such as "metadata.name,status" and
+// returns an error wrapping ErrFieldNotSelectable if a field is not in fieldMap.
+func ParseFields(fields string, fieldMap FieldMap) ([]string, error) {
+	names := splitList(fields)
+	for _, name := range names {
+		if _, err := fieldMap.column(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// identityColumns are selected by any projection, with the primary key:
+// keyset pagination orders by (createdAt, id) and the metav1.EncryptionPlugin
+// identifies the rows by their instanceID.
+var identityColumns = []string{"instanceID", "createdAt"}
+
+// SelectScope returns a gorm scope selecting the columns of fields, all the
+// columns if fields is empty. The primary key and the instanceID and createdAt
+// columns of the model are always selected, so are columns, e.g. the other
+// keyset columns of a paginate.Keyset.
+func SelectScope(fields string, fieldMap FieldMap, columns ...string) (func(*gorm.DB) *gorm.DB, error) {
+	names, err := ParseFields(fields, fieldMap)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		selected = append(selected, fieldMap[name])
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if counting(db) || len(selected) == 0 {
+			return db
+		}
+
+		return db.Select(uniqueColumns(append(append(modelIdentity(db), columns...), selected...)))
+	}, nil
+}
+
+// modelIdentity returns the primary key and the identity columns of the model of db.
+func modelIdentity(db *gorm.DB) []string {
+	model := db.Statement.Model
+	if model == nil {
+		model = db.Statement.Dest
+	}
+	if model == nil || db.Statement.Parse(model) != nil {
+		return nil
+	}
+
+	var columns []string
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		columns = append(columns, field.DBName)
+	}
+	for _, name := range identityColumns {
+		if field := db.Statement.Schema.LookUpField(name); field != nil && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+
+	return columns
+}
+
+func uniqueColumns(columns []string) []string {
+	unique := make([]string, 0, len(columns))
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		if !seen[column] {
+			seen[column] = true
+			unique = append(unique, column)
+		}
+	}
+
+	return unique
+}
+
+// ListOptionsScope returns a gorm scope applying the FieldSelector, SortBy and
+// Fields of opts, all validated against fieldMap. SortBy can not be used with
+// Continue, use paginate.FindKeyset without SortBy.
+func ListOptionsScope(opts *metav1.ListOptions, fieldMap FieldMap) (func(*gorm.DB) *gorm.DB, error) {
+	if opts == nil {
+		opts = &metav1.ListOptions{}
+	}
+	if opts.SortBy != "" && opts.Continue != "" {
+		return nil, ErrSortWithContinue
+	}
+
+	selectorScope, err := ScopeFromListOptions(opts, fieldMap)
+	if err != nil {
+		return nil, err
+	}
+	sortScope, err := SortScope(opts.SortBy, fieldMap)
+	if err != nil {
+		return nil, err
+	}
+	selectScope, err := SelectScope(opts.Fields, fieldMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(selectorScope, sortScope, selectScope)
+	}, nil
+}
+
+func (m FieldMap) column(field string) (string, error) {
+	column, ok := m[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %q, selectable fields are %s", ErrFieldNotSelectable, field,
+			strings.Join(m.Fields(), ", "))
+	}
+
+	return column, nil
+}
+
+// counting reports whether db runs a Count, which runs the scopes of the
+// query too and must keep counting rows.
+func counting(db *gorm.DB) bool {
+	_, ok := db.Statement.Dest.(*int64)
+
+	return ok
+}
+
+// splitList splits a comma separated list, ignoring spaces and empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -7,15 +7,18 @@ require (
 	github.com/marmotedu/component-base v1.6.2
 	github.com/tidwall/gjson v1.14.3
 	golang.org/x/crypto v0.0.0-20220829220503-c86fa9a7ed90
-	gorm.io/gorm v1.23.8
+	gorm.io/driver/sqlite v1.4.3
+	gorm.io/gorm v1.24.6
 )
 
 require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
-	github.com/jinzhu/now v1.1.4 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/json-iterator/go v1.1.10 // indirect
+	github.com/mattn/go-sqlite3 v1.14.15 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v0.0.0-20180701023420-4b7aa43c6742 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
 )
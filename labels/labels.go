@@ -0,0 +1,66 @@
+// Package labels parses and evaluates label selectors, in the syntax of
+// Kubernetes, e.g. "env in (prod,staging),tier!=frontend,!deprecated".
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bxsec/gotool/util/validation"
+)
+
+// Set is a set of labels, e.g. the labels of an object.
+type Set map[string]string
+
+// String returns the labels sorted by key as "k1=v1,k2=v2".
+func (s Set) String() string {
+	pairs := make([]string, 0, len(s))
+	for k, v := range s {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// Has reports whether the label key is set.
+func (s Set) Has(key string) bool {
+	_, ok := s[key]
+
+	return ok
+}
+
+// Get returns the value of the label key.
+func (s Set) Get(key string) string {
+	return s[key]
+}
+
+// AsSelector returns a selector matching the objects having all the labels of s.
+func (s Set) AsSelector() Selector {
+	requirements := make([]Requirement, 0, len(s))
+	for k, v := range s {
+		requirements = append(requirements, Requirement{Key: k, Operator: Equals, Values: []string{v}})
+	}
+	sortRequirements(requirements)
+
+	return Selector{Requirements: requirements}
+}
+
+// ValidateKey returns an error if key is not a valid label key: an optional
+// DNS subdomain prefix and '/', followed by a name of at most 63 alphanumeric
+// characters, '-', '_' or '.', starting and ending with an alphanumeric character.
+func ValidateKey(key string) error {
+	if err := validation.IsQualifiedName(key); err != nil {
+		return fmt.Errorf("invalid label key: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateValue returns an error if value is not a valid label value: empty,
+// or at most 63 alphanumeric characters, '-', '_' or '.', starting and ending
+// with an alphanumeric character.
+func ValidateValue(value string) error {
+	return validation.IsValidLabelValue(value)
+}
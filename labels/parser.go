@@ -0,0 +1,269 @@
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseError is returned when a selector can not be parsed, Pos is the byte
+// offset of the offending token in Input.
+type ParseError struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid label selector %q at position %d: %s", e.Input, e.Pos, e.Msg)
+}
+
+// emptyValue is the empty value written in a set of values.
+const emptyValue = `""`
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenComma
+	tokenNot
+	tokenEquals
+	tokenDoubleEquals
+	tokenNotEquals
+	tokenOpenParen
+	tokenCloseParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of selector"
+	}
+
+	return fmt.Sprintf("%q", t.value)
+}
+
+// lex splits input into tokens, identifiers are any run of characters other
+// than whitespace and the special characters ",!=()".
+func lex(input string) []token {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenOpenParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenCloseParen, ")", i})
+			i++
+		case c == '!' && i+1 < len(input) && input[i+1] == '=':
+			tokens = append(tokens, token{tokenNotEquals, "!=", i})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{tokenNot, "!", i})
+			i++
+		case c == '=' && i+1 < len(input) && input[i+1] == '=':
+			tokens = append(tokens, token{tokenDoubleEquals, "==", i})
+			i += 2
+		case c == '=':
+			tokens = append(tokens, token{tokenEquals, "=", i})
+			i++
+		default:
+			start := i
+			for i < len(input) && !strings.ContainsRune(" \t\n\r,!=()", rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdentifier, input[start:i], start})
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(input)})
+}
+
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &ParseError{Input: p.input, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses a selector such as "env in (prod,staging),tier!=frontend,!deprecated".
+// An empty selector matches everything.
+//
+// The grammar is:
+//
+//	selector    = [ requirement { "," requirement } ]
+//	requirement = [ "!" ] key
+//	            | key ( "=" | "==" | "!=" ) value
+//	            | key ( "in" | "notin" ) "(" value { "," value } ")"
+//
+// A value may be empty after '=', '==' and '!=', an empty value of a set must
+// be written as "".
+func Parse(selector string) (Selector, error) {
+	p := &parser{input: selector, tokens: lex(selector)}
+	if p.peek().kind == tokenEOF {
+		return Everything(), nil
+	}
+
+	var requirements []Requirement
+	for {
+		r, err := p.parseRequirement()
+		if err != nil {
+			return Selector{}, err
+		}
+		requirements = append(requirements, r)
+
+		t := p.next()
+		if t.kind == tokenEOF {
+			break
+		}
+		if t.kind != tokenComma {
+			return Selector{}, p.errorf(t, "expected ',' or end of selector, found %s", t)
+		}
+	}
+	sortRequirements(requirements)
+
+	return Selector{Requirements: requirements}, nil
+}
+
+func (p *parser) parseRequirement() (Requirement, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		key, err := p.parseKey()
+		if err != nil {
+			return Requirement{}, err
+		}
+
+		return Requirement{Key: key, Operator: DoesNotExist}, nil
+	}
+
+	key, err := p.parseKey()
+	if err != nil {
+		return Requirement{}, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokenComma || t.kind == tokenEOF:
+		return Requirement{Key: key, Operator: Exists}, nil
+	case t.kind == tokenEquals || t.kind == tokenDoubleEquals || t.kind == tokenNotEquals:
+		p.next()
+		op := Equals
+		if t.kind == tokenNotEquals {
+			op = NotEquals
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return Requirement{}, err
+		}
+
+		return Requirement{Key: key, Operator: op, Values: []string{value}}, nil
+	case t.kind == tokenIdentifier && (t.value == string(In) || t.value == string(NotIn)):
+		p.next()
+		values, err := p.parseValueSet()
+		if err != nil {
+			return Requirement{}, err
+		}
+
+		return Requirement{Key: key, Operator: Operator(t.value), Values: values}, nil
+	}
+
+	return Requirement{}, p.errorf(t, "expected operator '=', '==', '!=', 'in' or 'notin', found %s", t)
+}
+
+func (p *parser) parseKey() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier {
+		return "", p.errorf(t, "expected label key, found %s", t)
+	}
+	if err := ValidateKey(t.value); err != nil {
+		return "", p.errorf(t, "%v", err)
+	}
+
+	return t.value, nil
+}
+
+// parseValue parses the value after '=', '==' or '!=', which may be empty.
+func (p *parser) parseValue() (string, error) {
+	t := p.peek()
+	if t.kind == tokenComma || t.kind == tokenEOF {
+		return "", nil
+	}
+	p.next()
+
+	return p.value(t)
+}
+
+// value returns the label value of the identifier t, "" is the empty value.
+func (p *parser) value(t token) (string, error) {
+	if t.kind != tokenIdentifier {
+		return "", p.errorf(t, "expected label value, found %s", t)
+	}
+	if t.value == emptyValue {
+		return "", nil
+	}
+	if err := ValidateValue(t.value); err != nil {
+		return "", p.errorf(t, "%v", err)
+	}
+
+	return t.value, nil
+}
+
+func (p *parser) parseValueSet() ([]string, error) {
+	if t := p.next(); t.kind != tokenOpenParen {
+		return nil, p.errorf(t, "expected '(', found %s", t)
+	}
+
+	set := make(map[string]struct{})
+	for {
+		value, err := p.value(p.next())
+		if err != nil {
+			return nil, err
+		}
+		set[value] = struct{}{}
+
+		t := p.next()
+		if t.kind == tokenCloseParen {
+			break
+		}
+		if t.kind != tokenComma {
+			return nil, p.errorf(t, "expected ',' or ')', found %s", t)
+		}
+	}
+
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	return values, nil
+}
@@ -0,0 +1,131 @@
+package labels
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []Requirement
+		str      string
+	}{
+		{"", nil, ""},
+		{"env", []Requirement{{Key: "env", Operator: Exists}}, "env"},
+		{" !env ", []Requirement{{Key: "env", Operator: DoesNotExist}}, "!env"},
+		{"env=prod", []Requirement{{Key: "env", Operator: Equals, Values: []string{"prod"}}}, "env=prod"},
+		{"env==prod", []Requirement{{Key: "env", Operator: Equals, Values: []string{"prod"}}}, "env=prod"},
+		{"env!=prod", []Requirement{{Key: "env", Operator: NotEquals, Values: []string{"prod"}}}, "env!=prod"},
+		{"env=", []Requirement{{Key: "env", Operator: Equals, Values: []string{""}}}, "env="},
+		{`env=""`, []Requirement{{Key: "env", Operator: Equals, Values: []string{""}}}, "env="},
+		{
+			"env in (staging, prod, staging)",
+			[]Requirement{{Key: "env", Operator: In, Values: []string{"prod", "staging"}}},
+			"env in (prod,staging)",
+		},
+		{
+			`env notin ("",prod)`,
+			[]Requirement{{Key: "env", Operator: NotIn, Values: []string{"", "prod"}}},
+			`env notin ("",prod)`,
+		},
+		{
+			"tier!=frontend,example.com/app=web,!deprecated",
+			[]Requirement{
+				{Key: "deprecated", Operator: DoesNotExist},
+				{Key: "example.com/app", Operator: Equals, Values: []string{"web"}},
+				{Key: "tier", Operator: NotEquals, Values: []string{"frontend"}},
+			},
+			"!deprecated,example.com/app=web,tier!=frontend",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s.Requirements, tt.want) {
+				t.Errorf("got requirements %+v, want %+v", s.Requirements, tt.want)
+			}
+			if s.String() != tt.str {
+				t.Errorf("got %q, want %q", s.String(), tt.str)
+			}
+
+			again, err := Parse(s.String())
+			if err != nil || !reflect.DeepEqual(again, s) {
+				t.Errorf("round trip of %q: got %+v, %v", s.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		selector string
+		pos      int
+	}{
+		{"env in ()", 8},
+		{"env in (a,)", 10},
+		{"env in (,a)", 8},
+		{"env in (a b)", 10},
+		{"env in a", 7},
+		{"env in (a", 9},
+		{"env=a=b", 5},
+		{"env=(a)", 4},
+		{"env prod", 4},
+		{"env,", 4},
+		{",env", 0},
+		{"!", 1},
+		{"-env", 0},
+		{"env=-prod", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			_, err := Parse(tt.selector)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got %v, want a ParseError", err)
+			}
+			if parseErr.Pos != tt.pos || parseErr.Input != tt.selector {
+				t.Errorf("got error at %d of %q, want %d: %v", parseErr.Pos, parseErr.Input, tt.pos, err)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "tier": "", "app": "web"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"env", true},
+		{"!env", false},
+		{"!missing", true},
+		{"env=prod", true},
+		{"env!=prod", false},
+		{"missing!=prod", true},
+		{"tier=", true},
+		{`tier in ("",backend)`, true},
+		{"tier in (backend)", false},
+		{"env in (prod,staging),app=web", true},
+		{"env in (prod,staging),app=api", false},
+		{"env notin (staging)", true},
+		{"missing notin (staging)", true},
+		{"missing in (staging)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Matches(labels); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package labels
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultColumn is the column ObjectMeta stores its labels in, as JSON object.
+const DefaultColumn = "labels"
+
+// jsonDialect builds the SQL expressions reading a label from a JSON column.
+type jsonDialect struct {
+	// value extracts the label value, it is NULL if the label is missing.
+	value func(column string) string
+	// exists is true if the label is set.
+	exists func(column string) string
+	// arg is the query parameter of key.
+	arg func(key string) interface{}
+}
+
+func jsonPath(key string) interface{} {
+	// label keys can not contain quotes, see ValidateKey
+	return `$."` + key + `"`
+}
+
+var jsonDialects = map[string]jsonDialect{
+	"mysql": {
+		value:  func(column string) string { return "JSON_UNQUOTE(JSON_EXTRACT(" + column + ", ?))" },
+		exists: func(column string) string { return "JSON_CONTAINS_PATH(" + column + ", 'one', ?)" },
+		arg:    jsonPath,
+	},
+	"sqlite": {
+		value:  func(column string) string { return "json_extract(" + column + ", ?)" },
+		exists: func(column string) string { return "json_type(" + column + ", ?) IS NOT NULL" },
+		arg:    jsonPath,
+	},
+	"postgres": {
+		value:  func(column string) string { return "(" + column + "::jsonb ->> ?)" },
+		exists: func(column string) string { return "jsonb_exists(" + column + "::jsonb, ?)" },
+		arg:    func(key string) interface{} { return key },
+	},
+}
+
+// Scope returns a gorm scope restricting a query to the rows whose labels,
+// stored as JSON object in column, match the selector. MySQL, SQLite and
+// PostgreSQL are supported, the keys and values are passed as query parameters.
+// The JSON column can not use an index, combine the scope with indexed
+// conditions, e.g. on the owner, to keep large tables from being scanned.
+func (s Selector) Scope(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if s.Empty() {
+			return db
+		}
+
+		dialect, ok := jsonDialects[db.Dialector.Name()]
+		if !ok {
+			_ = db.AddError(fmt.Errorf("label selectors are not supported by %s", db.Dialector.Name()))
+
+			return db
+		}
+
+		quoted := db.Statement.Quote(column)
+		exprs := make([]clause.Expression, 0, len(s.Requirements))
+		for _, r := range s.Requirements {
+			exprs = append(exprs, r.expr(dialect, quoted))
+		}
+
+		return db.Where(clause.And(exprs...))
+	}
+}
+
+func (r Requirement) expr(dialect jsonDialect, column string) clause.Expression {
+	key := dialect.arg(r.Key)
+	value := dialect.value(column)
+
+	switch r.Operator {
+	case Exists:
+		return clause.Expr{SQL: dialect.exists(column), Vars: []interface{}{key}}
+	case DoesNotExist:
+		return clause.Expr{SQL: "NOT " + dialect.exists(column), Vars: []interface{}{key}}
+	case Equals:
+		return clause.Expr{SQL: value + " = ?", Vars: []interface{}{key, r.Values[0]}}
+	case NotEquals:
+		return clause.Expr{SQL: "(" + value + " IS NULL OR " + value + " <> ?)", Vars: []interface{}{key, key, r.Values[0]}}
+	case In:
+		return clause.Expr{SQL: value + " IN ?", Vars: []interface{}{key, r.Values}}
+	case NotIn:
+		return clause.Expr{SQL: "(" + value + " IS NULL OR " + value + " NOT IN ?)", Vars: []interface{}{key, key, r.Values}}
+	}
+
+	// a requirement not built by Parse
+	return clause.Expr{SQL: "1 = 0"}
+}
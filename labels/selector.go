@@ -0,0 +1,145 @@
+package labels
+
+import (
+	"sort"
+	"strings"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Operator is the operator of a Requirement.
+type Operator string
+
+// Define the operators of a requirement, `==` is parsed as Equals.
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is a condition on a single label, the AST of a selector term.
+type Requirement struct {
+	Key      string
+	Operator Operator
+
+	// Values are empty for Exists and DoesNotExist, hold a single value for
+	// Equals and NotEquals, and are sorted and deduplicated for In and NotIn.
+	Values []string
+}
+
+// Matches reports whether labels satisfy the requirement. NotEquals and NotIn
+// match the labels without the key.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && containsString(r.Values, value)
+	case NotEquals, NotIn:
+		return !ok || !containsString(r.Values, value)
+	}
+
+	return false
+}
+
+// String returns the requirement in canonical form.
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	case Equals, NotEquals:
+		return r.Key + string(r.Operator) + strings.Join(r.Values, "")
+	}
+
+	values := make([]string, 0, len(r.Values))
+	for _, v := range r.Values {
+		if v == "" {
+			v = emptyValue
+		}
+		values = append(values, v)
+	}
+
+	return r.Key + " " + string(r.Operator) + " (" + strings.Join(values, ",") + ")"
+}
+
+// Selector is a parsed label selector, it matches the labels satisfying all its requirements.
+type Selector struct {
+	Requirements []Requirement
+}
+
+// Everything returns a selector matching all labels.
+func Everything() Selector {
+	return Selector{}
+}
+
+// Empty reports whether the selector matches everything.
+func (s Selector) Empty() bool {
+	return len(s.Requirements) == 0
+}
+
+// Matches reports whether labels satisfy all the requirements.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.Requirements {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the selector in canonical form, parsing it returns the same selector.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s.Requirements))
+	for _, r := range s.Requirements {
+		terms = append(terms, r.String())
+	}
+
+	return strings.Join(terms, ",")
+}
+
+// Add returns a selector with the requirements of s and r.
+func (s Selector) Add(r ...Requirement) Selector {
+	requirements := append(append([]Requirement(nil), s.Requirements...), r...)
+	sortRequirements(requirements)
+
+	return Selector{Requirements: requirements}
+}
+
+// FromListOptions parses the LabelSelector of opts.
+func FromListOptions(opts *metav1.ListOptions) (Selector, error) {
+	if opts == nil {
+		return Everything(), nil
+	}
+
+	return Parse(opts.LabelSelector)
+}
+
+func sortRequirements(requirements []Requirement) {
+	sort.SliceStable(requirements, func(i, j int) bool {
+		if requirements[i].Key != requirements[j].Key {
+			return requirements[i].Key < requirements[j].Key
+		}
+
+		return requirements[i].Operator < requirements[j].Operator
+	})
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
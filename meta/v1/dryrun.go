@@ -0,0 +1,24 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DryRunAll processes all the dry run stages, the only valid DryRun value.
+const DryRunAll = "All"
+
+// ErrInvalidDryRun is returned when a DryRun value is not supported.
+var ErrInvalidDryRun = errors.New("invalid dry run value")
+
+// ValidateDryRun returns an error wrapping ErrInvalidDryRun if dryRun has a
+// value other than DryRunAll, and reports whether a dry run is requested.
+func ValidateDryRun(dryRun []string) (bool, error) {
+	for _, value := range dryRun {
+		if value != DryRunAll {
+			return false, fmt.Errorf("%w: %q, supported values are %q", ErrInvalidDryRun, value, DryRunAll)
+		}
+	}
+
+	return len(dryRun) > 0, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2020 Lingfei Kong <colin404@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package v1
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bxsec/gotool/util/aead"
+)
+
+// encryptedPrefix prefixes the values encrypted by an Encryptor, the format is
+// enc:v1:<keyID>:<wrapped data key>:<ciphertext>, the data key and the
+// plaintext are encrypted into base64url encoded aead envelopes.
+const encryptedPrefix = "enc:v1:"
+
+// dataKeySize is the size of the AES-256 data keys.
+const dataKeySize = aead.KeySize
+
+// Define the errors returned when encrypting or decrypting values.
+var (
+	ErrNoEncryptor      = errors.New("no encryptor configured")
+	ErrUnknownKeyID     = errors.New("unknown key encryption key id")
+	ErrInvalidEncrypted = errors.New("invalid encrypted value")
+	ErrNoRowIdentity    = errors.New("encrypted column of a row without identity")
+)
+
+// KeyProvider wraps the data keys of envelope encryption with key encryption
+// keys, e.g. held by a KMS. Key ids are stored with the values, so old keys
+// must stay available to UnwrapKey after a rotation.
+type KeyProvider interface {
+	// WrapKey encrypts dataKey with the current key encryption key.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts a data key wrapped by the key encryption key keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyProvider is a KeyProvider holding AES-256 key encryption keys in memory.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string]*aead.Cipher
+}
+
+var _ KeyProvider = &LocalKeyProvider{}
+
+// NewLocalKeyProvider creates a LocalKeyProvider wrapping with the key current,
+// keys maps the key ids to 32 bytes keys.
+func NewLocalKeyProvider(current string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, current)
+	}
+
+	p := &LocalKeyProvider{current: current, keys: make(map[string]*aead.Cipher, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		c, err := aead.NewCipher(aead.AES256GCM, key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		p.keys[id] = c
+	}
+
+	return p, nil
+}
+
+// WrapKey encrypts dataKey with the current key.
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	wrapped, err := p.keys[p.current].Encrypt(dataKey, []byte(p.current))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return p.current, wrapped, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by the key keyID.
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	c, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, keyID)
+	}
+
+	return c.Decrypt(wrapped, []byte(keyID))
+}
+
+// Encryptor encrypts values with AES-256-GCM under a random data key, which is
+// wrapped by a KeyProvider and stored with the value. The values are encrypted
+// into the envelopes of an aead.Cipher.
+type Encryptor struct {
+	provider KeyProvider
+}
+
+// NewEncryptor creates an Encryptor wrapping the data keys with provider.
+func NewEncryptor(provider KeyProvider) *Encryptor {
+	return &Encryptor{provider: provider}
+}
+
+// Encrypt encrypts plaintext into a string carrying the key id and the wrapped
+// data key. The ciphertext is bound to additionalData, which must be passed
+// again to Decrypt.
+func (e *Encryptor) Encrypt(ctx context.Context, plaintext, additionalData []byte) (string, error) {
+	dataKey, err := aead.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := e.provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("wrap data key: %w", err)
+	}
+
+	c, err := aead.NewCipher(aead.AES256GCM, dataKey)
+	if err != nil {
+		return "", err
+	}
+	// bind the ciphertext to its key id too, so the header can not be swapped
+	ciphertext, err := c.Encrypt(plaintext, valueAdditionalData(keyID, additionalData))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + keyID + ":" + base64.RawURLEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt with the same additionalData.
+func (e *Encryptor) Decrypt(ctx context.Context, value string, additionalData []byte) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !IsEncrypted(value) || len(parts) != 3 {
+		return nil, ErrInvalidEncrypted
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidEncrypted
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidEncrypted
+	}
+
+	dataKey, err := e.provider.UnwrapKey(ctx, parts[0], wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	c, err := aead.NewCipher(aead.AES256GCM, dataKey)
+	if err != nil {
+		return nil, ErrInvalidEncrypted
+	}
+	plaintext, err := c.Decrypt(ciphertext, valueAdditionalData(parts[0], additionalData))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEncrypted, err)
+	}
+
+	return plaintext, nil
+}
+
+// valueAdditionalData returns the additional data of a value, the key id can
+// not contain ':'.
+func valueAdditionalData(keyID string, additionalData []byte) []byte {
+	return append([]byte(keyID+":"), additionalData...)
+}
+
+// IsEncrypted reports whether value has been encrypted by an Encryptor.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// EncryptedString is a string column stored encrypted by the EncryptionPlugin
+// of the db. It holds the plaintext, except while being written.
+type EncryptedString string
+
+// GormDataType returns the column type of an EncryptedString.
+func (s EncryptedString) GormDataType() string {
+	return "text"
+}
+
+// Value implements driver.Valuer, it fails with ErrNoEncryptor unless the
+// value has been encrypted by the EncryptionPlugin. An empty string is stored as is.
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s != "" && !IsEncrypted(string(s)) {
+		return nil, ErrNoEncryptor
+	}
+
+	return string(s), nil
+}
+
+// Scan implements sql.Scanner, the value is decrypted by the EncryptionPlugin.
+func (s *EncryptedString) Scan(src interface{}) error {
+	data, err := scanEncrypted(src)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(data)
+
+	return nil
+}
+
+// EncryptedBytes is a binary column stored encrypted by the EncryptionPlugin
+// of the db. It holds the plaintext, except while being written.
+type EncryptedBytes []byte
+
+// GormDataType returns the column type of an EncryptedBytes.
+func (b EncryptedBytes) GormDataType() string {
+	return "text"
+}
+
+// Value implements driver.Valuer, it fails with ErrNoEncryptor unless the
+// value has been encrypted by the EncryptionPlugin. Nil is stored as NULL.
+func (b EncryptedBytes) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if !IsEncrypted(string(b)) {
+		return nil, ErrNoEncryptor
+	}
+
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner, the value is decrypted by the EncryptionPlugin.
+func (b *EncryptedBytes) Scan(src interface{}) error {
+	data, err := scanEncrypted(src)
+	if err != nil {
+		return err
+	}
+	*b = data
+
+	return nil
+}
+
+func scanEncrypted(src interface{}) ([]byte, error) {
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return append([]byte(nil), v...), nil
+	}
+
+	return nil, fmt.Errorf("can not scan %T into an encrypted field", src)
+}
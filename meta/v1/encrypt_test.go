@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEncryptor(t *testing.T) {
+	ctx := context.Background()
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, dataKeySize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEncryptor(provider)
+
+	ad := []byte("secret\x00secretKey\x00secret-1")
+	value, err := e.Encrypt(ctx, []byte("plaintext"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(value) {
+		t.Fatalf("%q is not encrypted", value)
+	}
+
+	plaintext, err := e.Decrypt(ctx, value, ad)
+	if err != nil || string(plaintext) != "plaintext" {
+		t.Fatalf("Decrypt() = %q, %v", plaintext, err)
+	}
+	if _, err := e.Decrypt(ctx, value, []byte("secret\x00secretKey\x00secret-2")); !errors.Is(err, ErrInvalidEncrypted) {
+		t.Fatalf("Decrypt() with the additional data of another row = %v, want ErrInvalidEncrypted", err)
+	}
+	if _, err := e.Decrypt(ctx, "enc:v1:k2:AA:AA", ad); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("Decrypt() with an unknown key id = %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestEncryptedValueRequiresPlugin(t *testing.T) {
+	if _, err := EncryptedString("plaintext").Value(); !errors.Is(err, ErrNoEncryptor) {
+		t.Fatalf("Value() = %v, want ErrNoEncryptor", err)
+	}
+	if _, err := EncryptedBytes("plaintext").Value(); !errors.Is(err, ErrNoEncryptor) {
+		t.Fatalf("Value() = %v, want ErrNoEncryptor", err)
+	}
+	if v, err := EncryptedString("").Value(); err != nil || v != "" {
+		t.Fatalf("Value() of an empty string = %v, %v", v, err)
+	}
+}
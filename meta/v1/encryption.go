@@ -0,0 +1,431 @@
+// Copyright 2020 Lingfei Kong <colin404@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// encryptedTag is the gorm tag setting marking a string or []byte field as
+// encrypted, e.g. `gorm:"column:extendShadow;encrypted"`.
+const encryptedTag = "ENCRYPTED"
+
+// instanceIDColumn is the column identifying the rows of the models embedding ObjectMeta.
+const instanceIDColumn = "instanceID"
+
+var (
+	encryptedStringType = reflect.TypeOf(EncryptedString(""))
+	encryptedBytesType  = reflect.TypeOf(EncryptedBytes(nil))
+)
+
+// EncryptionPlugin is a gorm plugin storing encrypted, with its Encryptor, the
+// fields of type EncryptedString and EncryptedBytes and the string fields
+// tagged `encrypted`, such as ObjectMeta.ExtendShadow, of the db it is used by:
+//
+//	db.Use(metav1.NewEncryptionPlugin(encryptor))
+//
+// Each value is bound to its table, column and row, so it can not be copied
+// to another row or column. The row is identified by its instanceID if the
+// model has one, or by its primary key otherwise. The encrypted fields of a
+// row whose primary key is assigned by the insert, such as an auto increment
+// id, are inserted empty and updated once the key is known. Queries reading
+// encrypted fields must select the identity of the rows.
+//
+// Every value written is encrypted, even if it looks encrypted already.
+// Without the plugin, saving an EncryptedString or EncryptedBytes fails with
+// ErrNoEncryptor, while tagged fields are stored in plaintext. Plaintext
+// values stored before the plugin was used are read as is, unless they start
+// with the prefix of the encrypted values.
+type EncryptionPlugin struct {
+	encryptor *Encryptor
+}
+
+var _ gorm.Plugin = &EncryptionPlugin{}
+
+// NewEncryptionPlugin creates an EncryptionPlugin encrypting with encryptor.
+func NewEncryptionPlugin(encryptor *Encryptor) *EncryptionPlugin {
+	return &EncryptionPlugin{encryptor: encryptor}
+}
+
+// Name implements gorm.Plugin.
+func (p *EncryptionPlugin) Name() string {
+	return "metav1:encryption"
+}
+
+// Initialize implements gorm.Plugin, it registers the callbacks encrypting the
+// fields after the Before hooks and restoring their plaintext before the After hooks.
+func (p *EncryptionPlugin) Initialize(db *gorm.DB) error {
+	create := db.Callback().Create()
+	if err := create.After("gorm:before_create").Before("gorm:create").
+		Register("metav1:encrypt", p.encrypt(true)); err != nil {
+		return err
+	}
+	if err := create.After("gorm:create").Before("gorm:after_create").
+		Register("metav1:encrypt_created", encryptCreated); err != nil {
+		return err
+	}
+	if err := create.After("metav1:encrypt_created").Before("gorm:after_create").
+		Register("metav1:restore_plaintext", restorePlaintext); err != nil {
+		return err
+	}
+
+	update := db.Callback().Update()
+	if err := update.After("gorm:before_update").Before("gorm:update").
+		Register("metav1:encrypt", p.encrypt(false)); err != nil {
+		return err
+	}
+	if err := update.After("gorm:update").Before("gorm:after_update").
+		Register("metav1:restore_plaintext", restorePlaintext); err != nil {
+		return err
+	}
+
+	return db.Callback().Query().After("gorm:query").Before("gorm:after_query").
+		Register("metav1:decrypt", p.decrypt)
+}
+
+// plaintextKey is the instance key of the functions restoring the plaintext
+// of the fields encrypted by a statement.
+const plaintextKey = "metav1:plaintext"
+
+// createdKey is the instance key of the functions encrypting the fields of
+// the rows created without identity.
+const createdKey = "metav1:created"
+
+func (p *EncryptionPlugin) encrypt(create bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		if db.Error != nil || stmt.Schema == nil {
+			return
+		}
+		selected, restricted := stmt.SelectAndOmitColumns(create, !create)
+		fields := encryptedFields(stmt.Schema, selected, restricted)
+		if len(fields) == 0 {
+			return
+		}
+
+		var (
+			restore []func()
+			created []func(*gorm.DB) error
+		)
+		defer func() {
+			db.InstanceSet(plaintextKey, restore)
+			db.InstanceSet(createdKey, created)
+		}()
+
+		encryptRow := func(row, identity reflect.Value) error {
+			var err error
+			restore, err = p.encryptRow(stmt, fields, row, identity, restore)
+			// the primary key of the row is assigned by the insert
+			if create && errors.Is(err, ErrNoRowIdentity) {
+				var fn func(*gorm.DB) error
+				restore, fn, err = p.deferRow(stmt, fields, row, restore)
+				created = append(created, fn)
+			}
+
+			return err
+		}
+
+		if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+			restore, db.Error = p.encryptMap(stmt, fields, dest)
+
+			return
+		}
+
+		// Updates with a struct other than the model writes its fields to the model row
+		rows, identities := stmt.ReflectValue, stmt.ReflectValue
+		if !create && stmt.Dest != stmt.Model {
+			rows = reflect.Indirect(reflect.ValueOf(stmt.Dest))
+		}
+
+		switch rows.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rows.Len() && db.Error == nil; i++ {
+				row := reflect.Indirect(rows.Index(i))
+				db.Error = encryptRow(row, row)
+			}
+		case reflect.Struct:
+			db.Error = encryptRow(rows, identities)
+		}
+	}
+}
+
+// encryptRow encrypts the fields of row, identified by the identity row.
+func (p *EncryptionPlugin) encryptRow(stmt *gorm.Statement, fields []*schema.Field, row, identity reflect.Value,
+	restore []func(),
+) ([]func(), error) {
+	id := ""
+	for _, field := range fields {
+		value := reflect.Indirect(field.ReflectValueOf(stmt.Context, row))
+		plaintext, ok := plaintextOf(value)
+		if !ok || len(plaintext) == 0 {
+			continue
+		}
+		if !value.CanSet() {
+			return restore, fmt.Errorf("%s.%s: can not encrypt an unaddressable value", stmt.Schema.Table, field.DBName)
+		}
+
+		if id == "" {
+			var err error
+			if id, err = rowIdentity(stmt.Context, stmt.Schema, identity); err != nil {
+				return restore, err
+			}
+		}
+		ciphertext, err := p.encryptor.Encrypt(stmt.Context, plaintext, columnAdditionalData(stmt.Schema, field, id))
+		if err != nil {
+			return restore, err
+		}
+
+		old := reflect.New(value.Type()).Elem()
+		old.Set(value)
+		restore = append(restore, func() { value.Set(old) })
+		setEncrypted(value, ciphertext)
+	}
+
+	return restore, nil
+}
+
+// deferRow inserts the encrypted fields of row empty, and returns the function
+// updating them with their ciphertext once the insert assigned the row its
+// primary key.
+func (p *EncryptionPlugin) deferRow(stmt *gorm.Statement, fields []*schema.Field, row reflect.Value,
+	restore []func(),
+) ([]func(), func(*gorm.DB) error, error) {
+	plaintexts := make(map[*schema.Field][]byte, len(fields))
+	for _, field := range fields {
+		value := reflect.Indirect(field.ReflectValueOf(stmt.Context, row))
+		plaintext, ok := plaintextOf(value)
+		if !ok || len(plaintext) == 0 {
+			continue
+		}
+		if !value.CanSet() {
+			return restore, nil, fmt.Errorf("%s.%s: can not encrypt an unaddressable value", stmt.Schema.Table, field.DBName)
+		}
+
+		old := reflect.New(value.Type()).Elem()
+		old.Set(value)
+		restore = append(restore, func() { value.Set(old) })
+		value.Set(reflect.Zero(value.Type()))
+		plaintexts[field] = plaintext
+	}
+
+	return restore, func(tx *gorm.DB) error {
+		if len(plaintexts) == 0 {
+			return nil
+		}
+		id, err := rowIdentity(stmt.Context, stmt.Schema, row)
+		if err != nil {
+			return err
+		}
+
+		columns := make(map[string]interface{}, len(plaintexts))
+		for field, plaintext := range plaintexts {
+			ciphertext, err := p.encryptor.Encrypt(stmt.Context, plaintext, columnAdditionalData(stmt.Schema, field, id))
+			if err != nil {
+				return err
+			}
+			columns[field.DBName] = ciphertext
+		}
+
+		var conds []clause.Expression
+		for _, field := range stmt.Schema.PrimaryFields {
+			value, _ := field.ValueOf(stmt.Context, row)
+			conds = append(conds, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+		}
+
+		// a table update has no schema, so it is neither encrypted again nor hooked
+		return tx.Table(stmt.Table).Clauses(clause.Where{Exprs: conds}).UpdateColumns(columns).Error
+	}, nil
+}
+
+// encryptCreated encrypts the fields of the rows created without identity,
+// within the transaction of the insert.
+func encryptCreated(db *gorm.DB) {
+	created, ok := db.InstanceGet(createdKey)
+	if !ok || db.Error != nil || db.DryRun {
+		return
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for _, fn := range created.([]func(*gorm.DB) error) {
+		if err := fn(tx); err != nil {
+			_ = db.AddError(err)
+
+			return
+		}
+	}
+}
+
+// encryptMap encrypts the encrypted fields of an update by map, the row is the model.
+func (p *EncryptionPlugin) encryptMap(stmt *gorm.Statement, fields []*schema.Field,
+	dest map[string]interface{},
+) ([]func(), error) {
+	var restore []func()
+	for _, field := range fields {
+		key := field.DBName
+		if _, ok := dest[key]; !ok {
+			key = field.Name
+		}
+		value, ok := dest[key]
+		if !ok {
+			continue
+		}
+		plaintext, ok := plaintextOf(reflect.Indirect(reflect.ValueOf(value)))
+		if !ok {
+			return restore, fmt.Errorf("%s.%s: can not encrypt %T", stmt.Schema.Table, field.DBName, value)
+		}
+		if len(plaintext) == 0 {
+			continue
+		}
+
+		if stmt.ReflectValue.Kind() != reflect.Struct {
+			return restore, fmt.Errorf("%w: %s.%s", ErrNoRowIdentity, stmt.Schema.Table, field.DBName)
+		}
+		id, err := rowIdentity(stmt.Context, stmt.Schema, stmt.ReflectValue)
+		if err != nil {
+			return restore, err
+		}
+		ciphertext, err := p.encryptor.Encrypt(stmt.Context, plaintext, columnAdditionalData(stmt.Schema, field, id))
+		if err != nil {
+			return restore, err
+		}
+
+		restore = append(restore, func() { dest[key] = value })
+		dest[key] = ciphertext
+		// gorm copies the values of the map to the model
+		if model := reflect.Indirect(field.ReflectValueOf(stmt.Context, stmt.ReflectValue)); model.CanSet() {
+			old := reflect.New(model.Type()).Elem()
+			old.Set(model)
+			restore = append(restore, func() { model.Set(old) })
+		}
+	}
+
+	return restore, nil
+}
+
+// restorePlaintext restores the plaintext of the fields encrypted by the
+// statement, whether it succeeded or not.
+func restorePlaintext(db *gorm.DB) {
+	if restore, ok := db.InstanceGet(plaintextKey); ok {
+		for _, fn := range restore.([]func()) {
+			fn()
+		}
+	}
+}
+
+func (p *EncryptionPlugin) decrypt(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	fields := encryptedFields(stmt.Schema, nil, false)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len() && db.Error == nil; i++ {
+			db.Error = p.decryptRow(stmt, fields, reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		db.Error = p.decryptRow(stmt, fields, stmt.ReflectValue)
+	}
+}
+
+func (p *EncryptionPlugin) decryptRow(stmt *gorm.Statement, fields []*schema.Field, row reflect.Value) error {
+	if row.Kind() != reflect.Struct {
+		return nil
+	}
+
+	id := ""
+	for _, field := range fields {
+		value := reflect.Indirect(field.ReflectValueOf(stmt.Context, row))
+		ciphertext, ok := plaintextOf(value)
+		if !ok || !IsEncrypted(string(ciphertext)) {
+			continue
+		}
+
+		if id == "" {
+			var err error
+			if id, err = rowIdentity(stmt.Context, stmt.Schema, row); err != nil {
+				return err
+			}
+		}
+		plaintext, err := p.encryptor.Decrypt(stmt.Context, string(ciphertext), columnAdditionalData(stmt.Schema, field, id))
+		if err != nil {
+			return fmt.Errorf("decrypt %s.%s: %w", stmt.Schema.Table, field.DBName, err)
+		}
+		setEncrypted(value, string(plaintext))
+	}
+
+	return nil
+}
+
+// encryptedFields returns the encrypted fields of s, restricted to the
+// selected ones if restricted is true.
+func encryptedFields(s *schema.Schema, selected map[string]bool, restricted bool) []*schema.Field {
+	var fields []*schema.Field
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if _, ok := field.TagSettings[encryptedTag]; !ok &&
+			field.FieldType != encryptedStringType && field.FieldType != encryptedBytesType {
+			continue
+		}
+		if v, ok := selected[field.DBName]; (ok && !v) || (!ok && restricted) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// rowIdentity returns the instanceID of row if its model has one, or its primary key.
+func rowIdentity(ctx context.Context, s *schema.Schema, row reflect.Value) (string, error) {
+	field := s.LookUpField(instanceIDColumn)
+	if field == nil {
+		field = s.PrioritizedPrimaryField
+	}
+	if field != nil {
+		if value, zero := field.ValueOf(ctx, row); !zero {
+			return fmt.Sprint(value), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNoRowIdentity, s.Table)
+}
+
+// columnAdditionalData binds a value to its table, column and row.
+func columnAdditionalData(s *schema.Schema, field *schema.Field, id string) []byte {
+	return []byte(s.Table + "\x00" + field.DBName + "\x00" + id)
+}
+
+func plaintextOf(value reflect.Value) ([]byte, bool) {
+	switch {
+	case value.Kind() == reflect.String:
+		return []byte(value.String()), true
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+		return value.Bytes(), true
+	}
+
+	return nil, false
+}
+
+func setEncrypted(value reflect.Value, data string) {
+	if value.Kind() == reflect.String {
+		value.SetString(data)
+	} else {
+		value.SetBytes([]byte(data))
+	}
+}
@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"bytes"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type encryptedNote struct {
+	ID   uint64 `gorm:"primaryKey"`
+	Text EncryptedString
+	Data EncryptedBytes
+}
+
+// newTestDB opens an in-memory sqlite database using the EncryptionPlugin with
+// the tables of models.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection opens another in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, dataKeySize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewEncryptionPlugin(NewEncryptor(provider))); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestEncryptAutoIncrementRows(t *testing.T) {
+	db := newTestDB(t, &encryptedNote{})
+
+	note := &encryptedNote{Text: "first", Data: EncryptedBytes("data")}
+	if err := db.Create(note).Error; err != nil {
+		t.Fatal(err)
+	}
+	notes := []*encryptedNote{{Text: "second"}, {Text: "third"}}
+	if err := db.Create(&notes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if note.ID == 0 || note.Text != "first" || notes[1].Text != "third" {
+		t.Fatalf("unexpected created notes %+v %+v", note, notes[1])
+	}
+
+	var stored []string
+	if err := db.Model(&encryptedNote{}).Order("id").Pluck("text", &stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range stored {
+		if !IsEncrypted(text) {
+			t.Errorf("text stored as %q, want it encrypted", text)
+		}
+	}
+
+	var got []*encryptedNote
+	if err := db.Order("id").Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Text != "first" || string(got[0].Data) != "data" || got[2].Text != "third" {
+		t.Errorf("unexpected notes %+v", got)
+	}
+}
+
+func TestEncryptValuesWithTheEncryptedPrefix(t *testing.T) {
+	db := newTestDB(t, &encryptedNote{})
+
+	plaintext := encryptedPrefix + "k1:AA:AA"
+	note := &encryptedNote{ID: 1, Text: EncryptedString(plaintext)}
+	if err := db.Create(note).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(note).Update("data", EncryptedBytes(plaintext)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var stored encryptedNote
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Raw("SELECT * FROM encrypted_notes").
+		Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Text == EncryptedString(plaintext) || string(stored.Data) == plaintext {
+		t.Errorf("stored %+v unencrypted", stored)
+	}
+
+	var got encryptedNote
+	if err := db.First(&got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Text) != plaintext || string(got.Data) != plaintext {
+		t.Errorf("got %+v, want %q", got, plaintext)
+	}
+}
@@ -29,6 +29,29 @@ type Object interface {
 	SetUpdatedAt(updatedAt time.Time)
 }
 
+// LabelsAccessor lets you work with the labels and annotations of the objects
+// embedding ObjectMeta. It is not part of Object, so that the implementations
+// of Object outside of this package keep satisfying it.
+type LabelsAccessor interface {
+	GetLabels() map[string]string
+	SetLabels(labels map[string]string)
+	GetAnnotations() map[string]string
+	SetAnnotations(annotations map[string]string)
+}
+
+// ResourceVersionAccessor lets you work with the ResourceVersion of the
+// objects embedding ObjectMeta, used for optimistic concurrency.
+type ResourceVersionAccessor interface {
+	GetResourceVersion() uint64
+	SetResourceVersion(version uint64)
+}
+
+// VersionedObject is an Object with a ResourceVersion.
+type VersionedObject interface {
+	Object
+	ResourceVersionAccessor
+}
+
 // ListInterface lets you work with list metadata from any of the versioned or
 // internal API objects. Attempting to set or retrieve a field on an object that does
 // not support that field will be a no-op and return a default value.
@@ -73,7 +96,11 @@ func (obj *ListMeta) GetListMeta() ListInterface { return obj }
 
 func (obj *ObjectMeta) GetObjectMeta() Object { return obj }
 
-var _ Object = &ObjectMeta{}
+var (
+	_ Object          = &ObjectMeta{}
+	_ LabelsAccessor  = &ObjectMeta{}
+	_ VersionedObject = &ObjectMeta{}
+)
 
 func (meta *ObjectMeta) GetID() uint64                    { return meta.ID }
 func (meta *ObjectMeta) SetID(id uint64)                  { meta.ID = id }
@@ -83,3 +110,13 @@ func (meta *ObjectMeta) GetCreatedAt() time.Time          { return meta.CreatedA
 func (meta *ObjectMeta) SetCreatedAt(createdAt time.Time) { meta.CreatedAt = createdAt }
 func (meta *ObjectMeta) GetUpdatedAt() time.Time          { return meta.UpdatedAt }
 func (meta *ObjectMeta) SetUpdatedAt(updatedAt time.Time) { meta.UpdatedAt = updatedAt }
+
+func (meta *ObjectMeta) GetLabels() map[string]string                 { return meta.Labels }
+func (meta *ObjectMeta) SetLabels(labels map[string]string)           { meta.Labels = labels }
+func (meta *ObjectMeta) GetAnnotations() map[string]string            { return meta.Annotations }
+func (meta *ObjectMeta) SetAnnotations(annotations map[string]string) { meta.Annotations = annotations }
+
+func (meta *ObjectMeta) GetResourceVersion() uint64 { return uint64(meta.ResourceVersion) }
+func (meta *ObjectMeta) SetResourceVersion(version uint64) {
+	meta.ResourceVersion = ResourceVersion(version)
+}
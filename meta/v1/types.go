@@ -9,6 +9,8 @@ import (
 
 	"github.com/marmotedu/component-base/pkg/json"
 	"gorm.io/gorm"
+
+	"github.com/bxsec/gotool/util/validation"
 )
 
 // Extend defines a new type used to store extended fields.
@@ -20,7 +22,8 @@ func (ext Extend) String() string {
 	return string(data)
 }
 
-// Merge merge extend fields from extendShadow.
+// Merge merge extend fields from extendShadow, as loaded from the database
+// and decrypted by the EncryptionPlugin.
 func (ext Extend) Merge(extendShadow string) Extend {
 	var extend Extend
 
@@ -56,6 +59,10 @@ type TypeMeta struct {
 // various status objects. A resource may have only one of {ObjectMeta, ListMeta}.
 type ListMeta struct {
 	TotalCount int64 `json:"totalCount,omitempty"`
+
+	// Continue is set if more items are available, pass it as ListOptions.Continue
+	// to get the next page.
+	Continue string `json:"continue,omitempty"`
 }
 
 // ObjectMeta is metadata that all persisted resources must have, which includes all objects
@@ -93,7 +100,27 @@ type ObjectMeta struct {
 	Extend Extend `json:"extend,omitempty" gorm:"-" validate:"omitempty"`
 
 	// ExtendShadow is the shadow of Extend. DO NOT modify directly.
-	ExtendShadow string `json:"-" gorm:"column:extendShadow" validate:"omitempty"`
+	// Stored encrypted if the db uses the EncryptionPlugin.
+	ExtendShadow string `json:"-" gorm:"column:extendShadow;encrypted" validate:"omitempty"`
+
+	// Labels are key/value pairs to organize and select objects, the keys are
+	// qualified names and the values are at most 63 characters.
+	// Stored as JSON, selectable with labels.Selector.Scope. The column is not
+	// indexed, so a selection scans the rows left by the other conditions;
+	// index a generated column per frequently selected key if that is too slow.
+	Labels map[string]string `json:"labels,omitempty" gorm:"column:labels;type:text;serializer:json"`
+
+	// Annotations are key/value pairs to attach arbitrary non-identifying
+	// metadata, the keys are qualified names. Annotations are not selectable.
+	Annotations map[string]string `json:"annotations,omitempty" gorm:"column:annotations;type:text;serializer:json"`
+
+	// ResourceVersion is an opaque value identifying the version of this object,
+	// clients pass it back on update to detect concurrent modifications.
+	// It is represented as a string in JSON, like in Kubernetes.
+	//
+	// Populated by the system, incremented in SQL on every update and soft delete.
+	// Read-only.
+	ResourceVersion ResourceVersion `json:"resourceVersion,string,omitempty" gorm:"column:resourceVersion;not null;default:1"`
 
 	// CreatedAt is a timestamp representing the server time when this object was
 	// created. It is not guaranteed to be set in happens-before order across separate operations.
@@ -118,25 +145,39 @@ type ObjectMeta struct {
 	//
 	// Populated by the system when a graceful deletion is requested.
 	// Read-only.
-	// DeletedAt gorm.DeletedAt `json:"-" gorm:"column:deletedAt;index:idx_deletedAt"`
+	// The index is named per table, as index names are global on SQLite and PostgreSQL.
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"column:deletedAt;index"`
 }
 
-// BeforeCreate run before create database record.
+// ResourceVersionColumn is the column of ObjectMeta.ResourceVersion.
+const ResourceVersionColumn = "resourceVersion"
+
+// BeforeCreate run before create database record, the ResourceVersion of a new
+// object is always 1.
 func (obj *ObjectMeta) BeforeCreate(tx *gorm.DB) error {
-	obj.ExtendShadow = obj.Extend.String()
+	obj.ResourceVersion = 1
 
-	return nil
+	return obj.beforeSave(tx)
 }
 
-// BeforeUpdate run before update database record.
+// BeforeUpdate run before update database record, the ResourceVersion is
+// incremented by its UpdateClauses.
 func (obj *ObjectMeta) BeforeUpdate(tx *gorm.DB) error {
-	obj.ExtendShadow = obj.Extend.String()
-
-	return nil
+	return obj.beforeSave(tx)
 }
 
 // AfterFind run after find to unmarshal a extend shadown string into metav1.Extend struct.
+// The EncryptionPlugin decrypts the ExtendShadow first, it is still encrypted
+// if the db does not use it.
 func (obj *ObjectMeta) AfterFind(tx *gorm.DB) error {
+	// extendShadow is empty if a projection does not select it
+	if obj.ExtendShadow == "" {
+		return nil
+	}
+	if IsEncrypted(obj.ExtendShadow) {
+		return ErrNoEncryptor
+	}
+
 	if err := json.Unmarshal([]byte(obj.ExtendShadow), &obj.Extend); err != nil {
 		return err
 	}
@@ -144,6 +185,21 @@ func (obj *ObjectMeta) AfterFind(tx *gorm.DB) error {
 	return nil
 }
 
+// beforeSave validates the labels and annotations, and stores Extend into
+// ExtendShadow.
+func (obj *ObjectMeta) beforeSave(tx *gorm.DB) error {
+	if err := validation.ValidateLabels(obj.Labels); err != nil {
+		return err
+	}
+	if err := validation.ValidateAnnotations(obj.Annotations); err != nil {
+		return err
+	}
+
+	obj.ExtendShadow = obj.Extend.String()
+
+	return nil
+}
+
 // ListOptions is the query options to a standard REST list call.
 type ListOptions struct {
 	TypeMeta `json:",inline"`
@@ -162,6 +218,25 @@ type ListOptions struct {
 
 	// Limit specify the number of records to be retrieved.
 	Limit *int64 `json:"limit,omitempty" form:"limit"`
+
+	// Continue is the opaque token of ListMeta.Continue returned with the previous page,
+	// used instead of Offset by keyset pagination.
+	Continue string `json:"continue,omitempty" form:"continue"`
+
+	// SortBy orders the list by comma separated fields, a field prefixed with
+	// '-' is sorted in descending order, e.g. "-createdAt,name".
+	SortBy string `json:"sortBy,omitempty" form:"sortBy"`
+
+	// Fields restricts the returned fields of the items to a comma separated list.
+	Fields string `json:"fields,omitempty" form:"fields"`
+
+	// IncludeDeleted lists the soft deleted objects too. It is not bound from
+	// requests, a handler sets it once the caller is authorized to see them.
+	IncludeDeleted bool `json:"-" form:"-"`
+
+	// OnlyDeleted lists the soft deleted objects only. It is not bound from
+	// requests, a handler sets it once the caller is authorized to see them.
+	OnlyDeleted bool `json:"-" form:"-"`
 }
 
 // ExportOptions is the query options to the standard REST get call.
@@ -186,6 +261,7 @@ type GetOptions struct {
 type DeleteOptions struct {
 	TypeMeta `json:",inline"`
 
+	// Unscoped deletes the object permanently instead of soft deleting it.
 	// +optional
 	Unscoped bool `json:"unscoped"`
 }
@@ -240,6 +316,12 @@ type UpdateOptions struct {
 // AuthorizeOptions may be provided when authorize an API object.
 type AuthorizeOptions struct {
 	TypeMeta `json:",inline"`
+
+	// Attributes of the request the conditions of the policies are evaluated
+	// against, e.g. the caller IP. They take precedence over the attributes
+	// carried by the context.
+	// +optional
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 // TableOptions are used when a Table is requested by the caller.
@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ResourceVersion is the type of ObjectMeta.ResourceVersion. As the Version
+// of gorm.io/plugin/optimisticlock, it registers gorm clauses incrementing it
+// in SQL on every update of its model, including UpdateColumn and
+// UpdateColumns, and on every soft delete.
+type ResourceVersion uint64
+
+// UpdateClauses implements schema.UpdateClausesInterface.
+func (ResourceVersion) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{versionUpdateClause{Field: f}}
+}
+
+// DeleteClauses implements schema.DeleteClausesInterface.
+func (ResourceVersion) DeleteClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{versionDeleteClause{Field: f}}
+}
+
+// versionUpdateClause increments the version column of an update.
+type versionUpdateClause struct {
+	Field *schema.Field
+}
+
+func (c versionUpdateClause) Name() string {
+	return ""
+}
+
+func (c versionUpdateClause) Build(clause.Builder) {
+}
+
+func (c versionUpdateClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement adds the increment to the SET clause, which gorm only
+// builds from the updated values if the statement has none yet.
+func (c versionUpdateClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() > 0 {
+		return
+	}
+
+	// the conversion copies the updated values, including a version, to the object
+	increment := incrementValue(stmt, c.Field)
+	set, ok := stmt.Clauses["SET"].Expression.(clause.Set)
+	if !ok {
+		if set = callbacks.ConvertToAssignments(stmt); len(set) == 0 {
+			return
+		}
+	}
+	stmt.AddClause(withIncrement(set, c.Field))
+	increment()
+}
+
+// versionDeleteClause increments the version column of a soft delete.
+type versionDeleteClause struct {
+	Field *schema.Field
+}
+
+func (c versionDeleteClause) Name() string {
+	return ""
+}
+
+func (c versionDeleteClause) Build(clause.Builder) {
+}
+
+func (c versionDeleteClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement runs the soft delete clause of the schema, which replaces
+// the SET clause and builds the statement at once, and builds the statement
+// again with the increment. It runs before the soft delete clause added by
+// gorm, as ObjectMeta declares ResourceVersion before DeletedAt, which then
+// finds the statement built already.
+func (c versionDeleteClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() > 0 || stmt.Unscoped {
+		return
+	}
+
+	for _, dc := range stmt.Schema.DeleteClauses {
+		softDelete, ok := dc.(gorm.SoftDeleteDeleteClause)
+		if !ok {
+			continue
+		}
+
+		softDelete.ModifyStatement(stmt)
+		set, _ := stmt.Clauses["SET"].Expression.(clause.Set)
+		stmt.AddClause(withIncrement(set, c.Field))
+		stmt.SQL.Reset()
+		stmt.Vars = nil
+		stmt.Build(stmt.DB.Callback().Update().Clauses...)
+		incrementValue(stmt, c.Field)()
+
+		return
+	}
+}
+
+// withIncrement returns set with field incremented, instead of set to the
+// value of the updated object.
+func withIncrement(set clause.Set, field *schema.Field) clause.Set {
+	assignments := make(clause.Set, 0, len(set)+1)
+	for _, a := range set {
+		if a.Column.Name != field.DBName {
+			assignments = append(assignments, a)
+		}
+	}
+
+	column := clause.Column{Name: field.DBName}
+
+	return append(assignments, clause.Assignment{Column: column, Value: gorm.Expr("? + 1", column)})
+}
+
+// incrementValue returns the function setting the version of the updated
+// object to its current version plus one, as in SQL.
+func incrementValue(stmt *gorm.Statement, field *schema.Field) func() {
+	if stmt.ReflectValue.Kind() != reflect.Struct || !stmt.ReflectValue.CanAddr() {
+		return func() {}
+	}
+
+	version := field.ReflectValueOf(stmt.Context, stmt.ReflectValue)
+	current := version.Uint()
+
+	return func() {
+		if version.CanSet() {
+			version.SetUint(current + 1)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package paginate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/bxsec/gotool/json"
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Define the errors of keyset pagination.
+var (
+	// ErrInvalidContinue is returned when a continue token is malformed, has
+	// been tampered with or belongs to another query.
+	ErrInvalidContinue = errors.New("invalid continue token")
+	ErrShortKeysetKey  = errors.New("keyset key is too short")
+
+	// ErrKeysetSorted is returned when a keyset page is requested with sortBy
+	// or from an ordered query, the rows are always ordered by (createdAt, id).
+	ErrKeysetSorted = errors.New("keyset pagination can not be sorted")
+)
+
+// MinKeysetKeySize is the minimum size of the keys signing continue tokens.
+const MinKeysetKeySize = 32
+
+// Define the columns keyset pagination orders by.
+const (
+	DefaultKeyColumn = "createdAt"
+	DefaultIDColumn  = "id"
+)
+
+// Cursor is the position after the last item of a page.
+type Cursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uint64    `json:"i"`
+}
+
+// Keyset pages through resources ordered by (createdAt, id), with continue
+// tokens signed by HMAC-SHA256 so clients can not forge positions. The
+// signature covers a digest of the query too, so a token can not be replayed
+// against another query, e.g. with other filters.
+type Keyset struct {
+	key       []byte
+	keyColumn string
+	idColumn  string
+}
+
+// KeysetOption defines optional parameters for a Keyset.
+type KeysetOption func(*Keyset)
+
+// WithColumns sets the columns of the creation time and the id, createdAt and id by default.
+func WithColumns(keyColumn, idColumn string) KeysetOption {
+	return func(k *Keyset) {
+		k.keyColumn = keyColumn
+		k.idColumn = idColumn
+	}
+}
+
+// NewKeyset creates a Keyset signing the continue tokens with key, which must
+// be at least MinKeysetKeySize random bytes.
+func NewKeyset(key []byte, opts ...KeysetOption) (*Keyset, error) {
+	if len(key) < MinKeysetKeySize {
+		return nil, fmt.Errorf("%w: %d bytes, must be at least %d", ErrShortKeysetKey, len(key), MinKeysetKeySize)
+	}
+
+	k := &Keyset{key: append([]byte(nil), key...), keyColumn: DefaultKeyColumn, idColumn: DefaultIDColumn}
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	return k, nil
+}
+
+// Encode returns the continue token of c, signed together with the digest of
+// the query, see QueryDigest.
+func (k *Keyset) Encode(c Cursor, query []byte) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(k.sign(payload, query)), nil
+}
+
+// Decode verifies a continue token issued for the query digest and returns its cursor.
+func (k *Keyset) Decode(token string, query []byte) (*Cursor, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidContinue
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidContinue
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, k.sign(payload, query)) {
+		return nil, ErrInvalidContinue
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidContinue
+	}
+
+	return &c, nil
+}
+
+func (k *Keyset) sign(payload, query []byte) []byte {
+	mac := hmac.New(sha256.New, k.key)
+	// the digest has a fixed size, so the payload can not be extended into it
+	mac.Write(query)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
+
+// QueryDigest returns the SHA-256 digest of the SQL and the arguments of the
+// query of T db runs, the continue tokens are bound to it. The arguments must
+// be the same for all the pages, e.g. a time is taken once by the client.
+func QueryDigest[T any](db *gorm.DB) ([]byte, error) {
+	var items []T
+	stmt := db.Session(&gorm.Session{DryRun: true}).Find(&items)
+	if stmt.Error != nil {
+		return nil, stmt.Error
+	}
+
+	h := sha256.New()
+	h.Write([]byte(stmt.Statement.SQL.String()))
+	for _, v := range stmt.Statement.Vars {
+		if t, ok := v.(time.Time); ok {
+			v = t.Round(0)
+		}
+		fmt.Fprintf(h, "\x00%T:%v", v, v)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// Scope returns a gorm scope selecting the rows after the continue token,
+// ordered by (createdAt, id). An empty token starts from the first row, a
+// token issued for another query digest is rejected.
+func (k *Keyset) Scope(token string, query []byte, limit int) (func(*gorm.DB) *gorm.DB, error) {
+	var cursor *Cursor
+	if token != "" {
+		var err error
+		if cursor, err = k.Decode(token, query); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		keyColumn, idColumn := db.Statement.Quote(k.keyColumn), db.Statement.Quote(k.idColumn)
+		if cursor != nil {
+			db = db.Where("("+keyColumn+", "+idColumn+") > (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+
+		return db.Order(keyColumn + ", " + idColumn).Limit(limit)
+	}, nil
+}
+
+// FindKeyset fetches the page after opts.Continue, and sets the Continue of
+// the list if more rows are available. The limit of opts applies as in Find,
+// the offset is ignored and the total count is not computed. db must not be
+// ordered and opts can not have a SortBy, the rows are ordered by
+// (createdAt, id). The tokens are only valid for the query of db, see QueryDigest.
+func FindKeyset[T metav1.Object](db *gorm.DB, k *Keyset, opts *metav1.ListOptions,
+	options ...Option) (*List[T], error) {
+	var token string
+	if opts != nil {
+		if opts.SortBy != "" {
+			return nil, ErrKeysetSorted
+		}
+		token = opts.Continue
+	}
+	if _, ok := db.Statement.Clauses["ORDER BY"]; ok {
+		return nil, ErrKeysetSorted
+	}
+	_, limit := Unpointer(opts, options...)
+
+	query, err := QueryDigest[T](db)
+	if err != nil {
+		return nil, err
+	}
+	// fetch one more row to know whether there is a next page
+	scope, err := k.Scope(token, query, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &List[T]{Items: []T{}}
+	if err := db.Session(&gorm.Session{}).Scopes(scope).Find(&list.Items).Error; err != nil {
+		return nil, err
+	}
+
+	if len(list.Items) > limit {
+		list.Items = list.Items[:limit]
+		last := list.Items[limit-1]
+		if list.Continue, err = k.Encode(Cursor{CreatedAt: last.GetCreatedAt(), ID: last.GetID()}, query); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
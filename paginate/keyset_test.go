@@ -0,0 +1,41 @@
+package paginate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeysetToken(t *testing.T) {
+	if _, err := NewKeyset([]byte("short")); !errors.Is(err, ErrShortKeysetKey) {
+		t.Fatalf("NewKeyset() = %v, want ErrShortKeysetKey", err)
+	}
+
+	k, err := NewKeyset(bytes.Repeat([]byte{1}, MinKeysetKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := Cursor{CreatedAt: time.Unix(1600000000, 0).UTC(), ID: 42}
+	query := bytes.Repeat([]byte{2}, 32)
+	token, err := k.Encode(cursor, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := k.Decode(token, query)
+	if err != nil || !got.CreatedAt.Equal(cursor.CreatedAt) || got.ID != cursor.ID {
+		t.Fatalf("Decode() = %v, %v, want %v", got, err, cursor)
+	}
+	if _, err := k.Decode(token, bytes.Repeat([]byte{3}, 32)); !errors.Is(err, ErrInvalidContinue) {
+		t.Fatalf("Decode() for another query = %v, want ErrInvalidContinue", err)
+	}
+
+	other, _ := NewKeyset(bytes.Repeat([]byte{4}, MinKeysetKeySize))
+	if _, err := other.Decode(token, query); !errors.Is(err, ErrInvalidContinue) {
+		t.Fatalf("Decode() with another key = %v, want ErrInvalidContinue", err)
+	}
+	if _, err := k.Decode(token+"x", query); !errors.Is(err, ErrInvalidContinue) {
+		t.Fatalf("Decode() of a tampered token = %v, want ErrInvalidContinue", err)
+	}
+}
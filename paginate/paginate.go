@@ -0,0 +1,106 @@
+// Package paginate turns the Offset and Limit of ListOptions into gorm
+// queries, and lists the resources with their total count.
+package paginate
+
+import (
+	"gorm.io/gorm"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Define the default page settings.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 1000
+)
+
+// List is a page of resources, with the total count of the resources matching the query.
+type List[T any] struct {
+	// Standard list metadata.
+	metav1.ListMeta `json:",inline"`
+
+	Items []T `json:"items"`
+}
+
+var _ metav1.ListInterface = &List[struct{}]{}
+
+// Option defines optional parameters of a page.
+type Option func(*config)
+
+type config struct {
+	defaultLimit int
+	maxLimit     int
+}
+
+// WithDefaultLimit sets the limit used when ListOptions has none.
+func WithDefaultLimit(limit int) Option {
+	return func(c *config) {
+		c.defaultLimit = limit
+	}
+}
+
+// WithMaxLimit sets the maximum limit, larger limits are lowered to it.
+func WithMaxLimit(limit int) Option {
+	return func(c *config) {
+		c.maxLimit = limit
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{defaultLimit: DefaultLimit, maxLimit: MaxLimit}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Unpointer returns the offset and limit of opts, with the defaults applied.
+// A negative offset is 0, a missing or non positive limit is the default limit,
+// and a limit above the maximum is the maximum.
+func Unpointer(opts *metav1.ListOptions, options ...Option) (offset, limit int) {
+	c := newConfig(options)
+
+	limit = c.defaultLimit
+	if opts != nil && opts.Offset != nil && *opts.Offset > 0 {
+		offset = int(*opts.Offset)
+	}
+	if opts != nil && opts.Limit != nil && *opts.Limit > 0 {
+		limit = int(*opts.Limit)
+	}
+	if c.maxLimit > 0 && limit > c.maxLimit {
+		limit = c.maxLimit
+	}
+
+	return offset, limit
+}
+
+// Scope returns a gorm scope selecting the page of opts.
+func Scope(opts *metav1.ListOptions, options ...Option) func(*gorm.DB) *gorm.DB {
+	offset, limit := Unpointer(opts, options...)
+
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset(offset).Limit(limit)
+	}
+}
+
+// Find counts the rows matched by db and fetches the page of opts. db carries
+// the conditions and order of the query, e.g. db.Where(...).Order("id desc").
+func Find[T any](db *gorm.DB, opts *metav1.ListOptions, options ...Option) (*List[T], error) {
+	// a new session, so the count and the fetch do not share their statement
+	db = db.Session(&gorm.Session{})
+
+	list := &List[T]{Items: []T{}}
+	if err := db.Model(new(T)).Count(&list.TotalCount).Error; err != nil {
+		return nil, err
+	}
+	if list.TotalCount == 0 {
+		return list, nil
+	}
+
+	if err := db.Scopes(Scope(opts, options...)).Find(&list.Items).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
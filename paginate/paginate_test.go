@@ -0,0 +1,131 @@
+package paginate
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestUnpointer(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       *metav1.ListOptions
+		options    []Option
+		wantOffset int
+		wantLimit  int
+	}{
+		{"nil options", nil, nil, 0, DefaultLimit},
+		{"no page", &metav1.ListOptions{}, nil, 0, DefaultLimit},
+		{"page", &metav1.ListOptions{Offset: int64Ptr(40), Limit: int64Ptr(10)}, nil, 40, 10},
+		{"negative offset", &metav1.ListOptions{Offset: int64Ptr(-1)}, nil, 0, DefaultLimit},
+		{"zero limit", &metav1.ListOptions{Limit: int64Ptr(0)}, nil, 0, DefaultLimit},
+		{"negative limit", &metav1.ListOptions{Limit: int64Ptr(-5)}, nil, 0, DefaultLimit},
+		{"limit above the maximum", &metav1.ListOptions{Limit: int64Ptr(MaxLimit + 1)}, nil, 0, MaxLimit},
+		{"default limit", nil, []Option{WithDefaultLimit(5)}, 0, 5},
+		{"max limit", &metav1.ListOptions{Limit: int64Ptr(50)}, []Option{WithMaxLimit(30)}, 0, 30},
+		{"default limit above the maximum", nil, []Option{WithDefaultLimit(50), WithMaxLimit(30)}, 0, 30},
+		{"no maximum", &metav1.ListOptions{Limit: int64Ptr(MaxLimit + 1)}, []Option{WithMaxLimit(0)}, 0, MaxLimit + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, limit := Unpointer(tt.opts, tt.options...)
+			if offset != tt.wantOffset || limit != tt.wantLimit {
+				t.Errorf("got offset %d limit %d, want %d %d", offset, limit, tt.wantOffset, tt.wantLimit)
+			}
+		})
+	}
+}
+
+type pageItem struct {
+	ID    uint64 `gorm:"primaryKey"`
+	Name  string `gorm:"column:name"`
+	Owner string `gorm:"column:owner"`
+}
+
+func TestFind(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection opens another in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&pageItem{}); err != nil {
+		t.Fatal(err)
+	}
+	var items []*pageItem
+	for i := 1; i <= 7; i++ {
+		owner := "alice"
+		if i%2 == 0 {
+			owner = "bob"
+		}
+		items = append(items, &pageItem{Name: fmt.Sprintf("item-%d", i), Owner: owner})
+	}
+	if err := db.Create(items).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	byOwner := func(owner string) func(*gorm.DB) *gorm.DB {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(db.Statement.Quote("owner")+" = ?", owner)
+		}
+	}
+	tests := []struct {
+		name      string
+		db        *gorm.DB
+		opts      *metav1.ListOptions
+		wantTotal int64
+		wantIDs   []uint64
+	}{
+		{"first page", db.Order("id"), &metav1.ListOptions{Limit: int64Ptr(3)}, 7, []uint64{1, 2, 3}},
+		{"last page", db.Order("id"), &metav1.ListOptions{Offset: int64Ptr(6), Limit: int64Ptr(3)}, 7, []uint64{7}},
+		{"past the end", db.Order("id"), &metav1.ListOptions{Offset: int64Ptr(7)}, 7, []uint64{}},
+		{
+			"negative offset", db.Order("id desc"),
+			&metav1.ListOptions{Offset: int64Ptr(-3), Limit: int64Ptr(2)}, 7, []uint64{7, 6},
+		},
+		{
+			"scoped", db.Scopes(byOwner("alice")).Order("id"),
+			&metav1.ListOptions{Offset: int64Ptr(1), Limit: int64Ptr(2)}, 4, []uint64{3, 5},
+		},
+		{"scoped twice", db.Scopes(byOwner("bob")).Where("id > ?", 2).Order("id"), nil, 2, []uint64{4, 6}},
+		{"no match", db.Scopes(byOwner("carol")), nil, 0, []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Find[pageItem](tt.db, tt.opts, WithMaxLimit(5))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []uint64{}
+			for _, item := range list.Items {
+				ids = append(ids, item.ID)
+			}
+			if list.TotalCount != tt.wantTotal || !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("got total %d items %v, want %d %v", list.TotalCount, ids, tt.wantTotal, tt.wantIDs)
+			}
+		})
+	}
+
+	list, err := Find[pageItem](db.Order("id"), &metav1.ListOptions{Limit: int64Ptr(100)}, WithMaxLimit(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.TotalCount != 7 || len(list.Items) != 5 {
+		t.Errorf("got total %d and %d items, want 7 and 5 clamped by the maximum", list.TotalCount, len(list.Items))
+	}
+}
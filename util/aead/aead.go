@@ -0,0 +1,153 @@
+// Package aead encrypts small payloads into versioned envelopes with an AEAD.
+// It is the envelope format of both auth.Cipher and the metav1 encrypted columns.
+package aead
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Define the errors returned when decrypting envelopes.
+var (
+	ErrInvalidCiphertext  = errors.New("invalid ciphertext")
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	ErrDecryptFailed      = errors.New("message authentication failed")
+)
+
+// Algorithm is the AEAD of an envelope.
+type Algorithm byte
+
+// Define the algorithms, both take 32 bytes keys.
+const (
+	XChaCha20Poly1305 Algorithm = 1
+	AES256GCM         Algorithm = 2
+)
+
+// envelopeVersion is the first byte of the envelopes, followed by the
+// algorithm, the nonce and the ciphertext.
+const envelopeVersion = 1
+
+// KeySize is the size of the keys of a Cipher.
+const KeySize = 32
+
+// GenerateKey returns a random key for NewCipher.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Cipher encrypts small payloads into versioned envelopes with an AEAD.
+type Cipher struct {
+	alg Algorithm
+	key []byte
+}
+
+// NewCipher creates a Cipher encrypting with alg. It decrypts the envelopes
+// of both algorithms, so the algorithm can be changed later.
+func NewCipher(alg Algorithm, key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes", KeySize)
+	}
+	if _, err := newAEAD(alg, key); err != nil {
+		return nil, err
+	}
+
+	return &Cipher{alg: alg, key: append([]byte(nil), key...)}, nil
+}
+
+func newAEAD(alg Algorithm, key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case XChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	case AES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return cipher.NewGCM(block)
+	}
+
+	return nil, fmt.Errorf("unsupported cipher algorithm %d", alg)
+}
+
+// Encrypt encrypts plaintext, additionalData is authenticated but not encrypted
+// and must be passed to Decrypt again.
+func (c *Cipher) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(c.alg, c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []byte{envelopeVersion, byte(c.alg)}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+aead.Overhead())
+	envelope = append(append(envelope, header...), nonce...)
+
+	// the header is authenticated too, so the algorithm can not be downgraded
+	return aead.Seal(envelope, nonce, plaintext, append(header, additionalData...)), nil
+}
+
+// Decrypt decrypts an envelope returned by Encrypt.
+func (c *Cipher) Decrypt(envelope, additionalData []byte) ([]byte, error) {
+	if len(envelope) < 2 {
+		return nil, ErrInvalidCiphertext
+	}
+	if envelope[0] != envelopeVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, envelope[0])
+	}
+	aead, err := newAEAD(Algorithm(envelope[1]), c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	header, rest := envelope[:2], envelope[2:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():],
+		append(append([]byte(nil), header...), additionalData...))
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+
+	return plaintext, nil
+}
+
+// EncryptString encrypts plaintext into a base64url encoded envelope.
+func (c *Cipher) EncryptString(plaintext string) (string, error) {
+	envelope, err := c.Encrypt([]byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(envelope), nil
+}
+
+// DecryptString decrypts an envelope returned by EncryptString.
+func (c *Cipher) DecryptString(envelope string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(envelope)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	plaintext, err := c.Decrypt(data, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
@@ -0,0 +1,49 @@
+package aead
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []Algorithm{XChaCha20Poly1305, AES256GCM} {
+		c, err := NewCipher(alg, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelope, err := c.Encrypt([]byte("plaintext"), []byte("ad"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if envelope[0] != envelopeVersion || Algorithm(envelope[1]) != alg {
+			t.Fatalf("envelope header = %v", envelope[:2])
+		}
+
+		plaintext, err := c.Decrypt(envelope, []byte("ad"))
+		if err != nil || string(plaintext) != "plaintext" {
+			t.Fatalf("Decrypt() = %q, %v", plaintext, err)
+		}
+		if _, err := c.Decrypt(envelope, []byte("other")); !errors.Is(err, ErrDecryptFailed) {
+			t.Fatalf("Decrypt() with other additional data = %v, want ErrDecryptFailed", err)
+		}
+
+		// the algorithm is authenticated, so it can not be switched
+		envelope[1] = byte(XChaCha20Poly1305 + AES256GCM - alg)
+		if _, err := c.Decrypt(envelope, []byte("ad")); err == nil {
+			t.Fatal("Decrypt() accepted an envelope with another algorithm")
+		}
+		envelope[0] = envelopeVersion + 1
+		if _, err := c.Decrypt(envelope, []byte("ad")); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatalf("Decrypt() = %v, want ErrUnsupportedVersion", err)
+		}
+	}
+
+	if _, err := NewCipher(AES256GCM, key[:16]); err == nil {
+		t.Fatal("NewCipher() accepted a short key")
+	}
+}
@@ -0,0 +1,123 @@
+package gormutil
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// DryRun runs fn with db, or inside a transaction always rolled back if
+// dryRun requests a dry run, so the hooks and the database constraints are
+// checked without persisting anything. dryRun is validated by metav1.ValidateDryRun.
+func DryRun(db *gorm.DB, dryRun []string, fn func(tx *gorm.DB) error) error {
+	ok, err := metav1.ValidateDryRun(dryRun)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fn(db)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+
+	return err
+}
+
+// Create creates obj, or fills in the fields populated by the system such as
+// the timestamps without persisting it if opts requests a dry run. The primary
+// keys assigned by the database during a dry run are reset, as they are rolled back.
+func Create(db *gorm.DB, obj interface{}, opts metav1.CreateOptions) error {
+	dryRun, err := metav1.ValidateDryRun(opts.DryRun)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		return db.Create(obj).Error
+	}
+
+	reset, err := unsetPrimaryKeys(db, obj)
+	if err != nil {
+		return err
+	}
+	if err := DryRun(db, opts.DryRun, func(tx *gorm.DB) error {
+		return tx.Create(obj).Error
+	}); err != nil {
+		return err
+	}
+	reset()
+
+	return nil
+}
+
+// unsetPrimaryKeys returns a function setting back to zero the primary keys
+// of obj, a struct or a slice, which are zero now.
+func unsetPrimaryKeys(db *gorm.DB, obj interface{}) (func(), error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(obj); err != nil {
+		return nil, err
+	}
+
+	ctx := db.Statement.Context
+	var resets []func()
+	unset := func(row reflect.Value) {
+		for _, field := range stmt.Schema.PrimaryFields {
+			if _, zero := field.ValueOf(ctx, row); zero {
+				field := field
+				resets = append(resets, func() {
+					_ = field.Set(ctx, row, reflect.Zero(field.FieldType).Interface())
+				})
+			}
+		}
+	}
+
+	switch rows := reflect.Indirect(reflect.ValueOf(obj)); rows.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rows.Len(); i++ {
+			unset(reflect.Indirect(rows.Index(i)))
+		}
+	case reflect.Struct:
+		unset(rows)
+	}
+
+	return func() {
+		for _, reset := range resets {
+			reset()
+		}
+	}, nil
+}
+
+// Update saves obj with UpdateVersion, or sets it to the would-be object
+// without persisting it if opts requests a dry run.
+func Update(db *gorm.DB, obj metav1.VersionedObject, opts metav1.UpdateOptions) error {
+	return DryRun(db, opts.DryRun, func(tx *gorm.DB) error {
+		return UpdateVersion(tx, obj, obj)
+	})
+}
+
+// Patch updates the columns of obj in values with UpdateVersion and reloads
+// obj. If opts requests a dry run obj is set to the would-be object without
+// persisting it.
+func Patch(db *gorm.DB, obj metav1.VersionedObject, values map[string]interface{}, opts metav1.PatchOptions) error {
+	return DryRun(db, opts.DryRun, func(tx *gorm.DB) error {
+		if err := UpdateVersion(tx, obj, values); err != nil {
+			return err
+		}
+
+		return tx.First(obj).Error
+	})
+}
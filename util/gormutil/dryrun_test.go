@@ -0,0 +1,118 @@
+package gormutil
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+var dryRunAll = []string{metav1.DryRunAll}
+
+func TestDryRun(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+
+	err := DryRun(db, []string{"Some"}, func(tx *gorm.DB) error { return nil })
+	if !errors.Is(err, metav1.ErrInvalidDryRun) {
+		t.Errorf("got %v, want %v", err, metav1.ErrInvalidDryRun)
+	}
+
+	errFailed := errors.New("failed")
+	err = DryRun(db, dryRunAll, func(tx *gorm.DB) error {
+		createObjects(t, tx, "a")
+
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("got %v, want %v", err, errFailed)
+	}
+
+	if err := DryRun(db, nil, func(tx *gorm.DB) error {
+		createObjects(t, tx, "b")
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := countObjects(t, db); n != 1 {
+		t.Errorf("%d objects, want the one created without dry run", n)
+	}
+}
+
+func TestCreateDryRun(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+
+	obj := &testObject{ObjectMeta: metav1.ObjectMeta{InstanceID: "obj-a", Name: "a"}}
+	if err := Create(db, obj, metav1.CreateOptions{DryRun: dryRunAll}); err != nil {
+		t.Fatal(err)
+	}
+	if obj.ID != 0 {
+		t.Errorf("got id %d, want the rolled back id reset", obj.ID)
+	}
+	if obj.CreatedAt.IsZero() || obj.ResourceVersion != 1 {
+		t.Errorf("the system populated fields are not filled in: %+v", obj.ObjectMeta)
+	}
+
+	withID := &testObject{ObjectMeta: metav1.ObjectMeta{ID: 42, InstanceID: "obj-b", Name: "b"}}
+	if err := Create(db, withID, metav1.CreateOptions{DryRun: dryRunAll}); err != nil {
+		t.Fatal(err)
+	}
+	if withID.ID != 42 {
+		t.Errorf("got id %d, want the id set before", withID.ID)
+	}
+
+	invalid := &testObject{ObjectMeta: metav1.ObjectMeta{
+		InstanceID: "obj-c", Name: "c", Labels: map[string]string{"-invalid": "x"},
+	}}
+	if err := Create(db, invalid, metav1.CreateOptions{DryRun: dryRunAll}); err == nil {
+		t.Error("the hooks did not validate the labels")
+	}
+
+	if n := countObjects(t, db); n != 0 {
+		t.Errorf("%d objects created by dry runs", n)
+	}
+}
+
+func TestUpdateDryRun(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	obj := createObjects(t, db, "a")[0]
+
+	obj.Status = "updated"
+	if err := Update(db, obj, metav1.UpdateOptions{DryRun: dryRunAll}); err != nil {
+		t.Fatal(err)
+	}
+	if obj.ResourceVersion != 2 || obj.Status != "updated" {
+		t.Errorf("got %+v, want the would-be object", obj)
+	}
+
+	var stored testObject
+	if err := db.First(&stored, obj.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ResourceVersion != 1 || stored.Status != "ok" {
+		t.Errorf("the dry run updated %+v", stored)
+	}
+}
+
+func TestPatchDryRun(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	obj := createObjects(t, db, "a")[0]
+
+	err := Patch(db, obj, map[string]interface{}{"status": "patched"}, metav1.PatchOptions{DryRun: dryRunAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.ResourceVersion != 2 || obj.Status != "patched" || obj.Name != "a" {
+		t.Errorf("got %+v, want the would-be object", obj)
+	}
+
+	var stored testObject
+	if err := db.First(&stored, obj.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ResourceVersion != 1 || stored.Status != "ok" {
+		t.Errorf("the dry run patched %+v", stored)
+	}
+}
@@ -0,0 +1,88 @@
+// Package gormutil provides gorm helpers for the resources embedding metav1.ObjectMeta.
+package gormutil
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// DeletedAtColumn is the column of metav1.ObjectMeta.DeletedAt.
+const DeletedAtColumn = "deletedAt"
+
+// Delete soft deletes the rows of value matching conds, or deletes them
+// permanently if opts.Unscoped is true.
+func Delete(db *gorm.DB, value interface{}, opts metav1.DeleteOptions, conds ...interface{}) *gorm.DB {
+	if opts.Unscoped {
+		db = db.Unscoped()
+	}
+
+	return db.Delete(value, conds...)
+}
+
+// Restore undeletes the soft deleted rows of model matching query and args,
+// and increments their ResourceVersion. It returns gorm.ErrRecordNotFound if
+// no soft deleted row matches.
+func Restore(db *gorm.DB, model interface{}, query interface{}, args ...interface{}) error {
+	return updated(db.Unscoped().Model(model).Where(query, args...).
+		Where(db.Statement.Quote(DeletedAtColumn)+" IS NOT NULL").
+		UpdateColumn(DeletedAtColumn, nil))
+}
+
+// DeletedScope returns a gorm scope listing the soft deleted rows too if
+// opts.IncludeDeleted is true, or only them if opts.OnlyDeleted is true.
+// Both are set by the handlers, after checking the caller may list deleted objects.
+func DeletedScope(opts *metav1.ListOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch {
+		case opts == nil:
+			return db
+		case opts.OnlyDeleted:
+			return db.Unscoped().Where(db.Statement.Quote(DeletedAtColumn) + " IS NOT NULL")
+		case opts.IncludeDeleted:
+			return db.Unscoped()
+		}
+
+		return db
+	}
+}
+
+// Purge permanently deletes the rows of model soft deleted more than retention ago.
+func Purge(ctx context.Context, db *gorm.DB, model interface{}, retention time.Duration) (int64, error) {
+	result := db.WithContext(ctx).Unscoped().
+		Where(db.Statement.Quote(DeletedAtColumn)+" < ?", time.Now().Add(-retention)).
+		Delete(model)
+
+	return result.RowsAffected, result.Error
+}
+
+// PurgeEvery runs Purge on models every interval until ctx is done, the
+// errors are logged.
+func PurgeEvery(ctx context.Context, db *gorm.DB, interval, retention time.Duration, models ...interface{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, model := range models {
+			n, err := Purge(ctx, db, model, retention)
+			if err != nil {
+				log.Printf("gormutil: purge %T: %v", model, err)
+
+				continue
+			}
+			if n > 0 {
+				log.Printf("gormutil: purged %d soft deleted %T", n, model)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
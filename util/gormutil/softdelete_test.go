@@ -0,0 +1,185 @@
+package gormutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+type testObject struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status string `json:"status" gorm:"column:status"`
+}
+
+// TableName maps to mysql table name.
+func (o *testObject) TableName() string {
+	return "test_object"
+}
+
+// newTestDB opens an in-memory sqlite database with the tables of models.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection opens another in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// createObjects creates the objects named names.
+func createObjects(t *testing.T, db *gorm.DB, names ...string) []*testObject {
+	t.Helper()
+
+	objs := make([]*testObject, 0, len(names))
+	for _, name := range names {
+		obj := &testObject{ObjectMeta: metav1.ObjectMeta{InstanceID: "obj-" + name, Name: name}, Status: "ok"}
+		if err := db.Create(obj).Error; err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs
+}
+
+func countObjects(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&testObject{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestDelete(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	objs := createObjects(t, db, "a", "b")
+
+	if err := Delete(db, objs[0], metav1.DeleteOptions{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&testObject{}, objs[0].ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	var deleted testObject
+	if err := db.Unscoped().First(&deleted, objs[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !deleted.DeletedAt.Valid {
+		t.Error("the soft deleted object has no deletedAt")
+	}
+
+	if err := Delete(db, &testObject{}, metav1.DeleteOptions{Unscoped: true}, objs[1].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := countObjects(t, db.Unscoped()); n != 1 {
+		t.Errorf("%d objects left, want the soft deleted one", n)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	objs := createObjects(t, db, "a", "b")
+	if err := db.Delete(objs[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(db, &testObject{}, "name = ?", "a"); err != nil {
+		t.Fatal(err)
+	}
+	var restored testObject
+	if err := db.First(&restored, objs[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt.Valid || restored.Status != "ok" {
+		t.Errorf("unexpected restored object %+v", restored)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := Restore(db, &testObject{}, "name = ?", name); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("restore of %s: got %v, want %v", name, err, gorm.ErrRecordNotFound)
+		}
+	}
+}
+
+func TestDeletedScope(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	objs := createObjects(t, db, "a", "b", "c")
+	if err := db.Delete(objs[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts *metav1.ListOptions
+		want []string
+	}{
+		{"nil options", nil, []string{"a", "c"}},
+		{"not deleted", &metav1.ListOptions{}, []string{"a", "c"}},
+		{"include deleted", &metav1.ListOptions{IncludeDeleted: true}, []string{"a", "b", "c"}},
+		{"only deleted", &metav1.ListOptions{OnlyDeleted: true}, []string{"b"}},
+		{"only deleted wins", &metav1.ListOptions{IncludeDeleted: true, OnlyDeleted: true}, []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			err := db.Model(&testObject{}).Scopes(DeletedScope(tt.opts)).Order("id").Pluck("name", &names).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, &testObject{})
+	objs := createObjects(t, db, "a", "b", "c")
+	for _, obj := range objs[:2] {
+		if err := db.Delete(obj).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.Unscoped().Model(objs[0]).UpdateColumn(DeletedAtColumn, time.Now().Add(-2*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Purge(ctx, db, &testObject{}, time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("Purge() = %d, %v, want 1 purged", n, err)
+	}
+	if err := db.Unscoped().First(&testObject{}, objs[0].ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("the object deleted before the retention: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if n := countObjects(t, db.Unscoped()); n != 2 {
+		t.Errorf("%d objects left, want the recently deleted one and the live one", n)
+	}
+}
@@ -0,0 +1,107 @@
+package gormutil
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+// Define the errors returned by the versioned updates.
+var (
+	// ErrConflict is matched by errors.Is for a *ConflictError.
+	ErrConflict = errors.New("the object has been modified")
+
+	// ErrMissingResourceVersion is returned by UpdateVersion for an object
+	// without ResourceVersion, use UpdateUnconditionally to overwrite it.
+	ErrMissingResourceVersion = errors.New("the object has no resource version")
+)
+
+// systemColumns are the columns of metav1.ObjectMeta populated by the system,
+// which an update of all the columns of an object leaves as stored.
+var systemColumns = []string{"id", "instanceID", "createdAt", DeletedAtColumn}
+
+// ConflictError is returned when an object is updated from a stale ResourceVersion.
+type ConflictError struct {
+	ID              uint64
+	ResourceVersion uint64
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%v: object %d is not at resource version %d anymore, "+
+		"apply your changes to the latest version and try again", ErrConflict, e.ID, e.ResourceVersion)
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// UpdateVersion updates the columns of obj in values, a map, or all the
+// columns but the ones populated by the system if values is obj, only if the
+// stored ResourceVersion is still the one of obj, which is incremented. It
+// returns a *ConflictError on mismatch, gorm.ErrRecordNotFound if obj does
+// not exist, and ErrMissingResourceVersion if obj has no ResourceVersion.
+func UpdateVersion(db *gorm.DB, obj metav1.VersionedObject, values interface{}) error {
+	version := obj.GetResourceVersion()
+	if version == 0 {
+		return ErrMissingResourceVersion
+	}
+
+	err := update(db.Where(db.Statement.Quote(metav1.ResourceVersionColumn)+" = ?", version), obj, values)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var count int64
+		if err = db.Model(obj).Where(db.Statement.Quote("id")+" = ?", obj.GetID()).Count(&count).Error; err == nil {
+			err = gorm.ErrRecordNotFound
+			if count > 0 {
+				err = &ConflictError{ID: obj.GetID(), ResourceVersion: version}
+			}
+		}
+	}
+	if err != nil {
+		obj.SetResourceVersion(version)
+
+		return err
+	}
+
+	return nil
+}
+
+// UpdateUnconditionally updates obj as UpdateVersion does, whatever its
+// stored ResourceVersion, which is incremented. It overwrites the concurrent
+// updates of obj.
+func UpdateUnconditionally(db *gorm.DB, obj metav1.VersionedObject, values interface{}) error {
+	version := obj.GetResourceVersion()
+	if err := update(db, obj, values); err != nil {
+		obj.SetResourceVersion(version)
+
+		return err
+	}
+
+	return nil
+}
+
+func update(db *gorm.DB, obj metav1.VersionedObject, values interface{}) error {
+	tx := db.Model(obj)
+	if values == obj {
+		// update the zero values too, as Save does
+		tx = tx.Select("*").Omit(systemColumns...)
+	}
+
+	return updated(tx.Updates(values))
+}
+
+// updated returns gorm.ErrRecordNotFound if result did not change any row.
+func updated(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
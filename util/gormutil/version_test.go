@@ -0,0 +1,206 @@
+package gormutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	metav1 "github.com/bxsec/gotool/meta/v1"
+)
+
+func storedVersion(t *testing.T, db *gorm.DB, id uint64) uint64 {
+	t.Helper()
+
+	var stored testObject
+	if err := db.Unscoped().First(&stored, id).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return stored.GetResourceVersion()
+}
+
+func TestUpdateVersion(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	obj := createObjects(t, db, "a")[0]
+	if obj.ResourceVersion != 1 {
+		t.Fatalf("created at version %d, want 1", obj.ResourceVersion)
+	}
+	stale := *obj
+
+	obj.Status = "updated"
+	if err := UpdateVersion(db, obj, obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.ResourceVersion != 2 || storedVersion(t, db, obj.ID) != 2 {
+		t.Errorf("got version %d, stored %d, want 2", obj.ResourceVersion, storedVersion(t, db, obj.ID))
+	}
+
+	stale.Status = "stale"
+	err := UpdateVersion(db, &stale, &stale)
+	var conflict *ConflictError
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("got %v, want a ConflictError", err)
+	}
+	if conflict.ID != obj.ID || conflict.ResourceVersion != 1 || stale.ResourceVersion != 1 {
+		t.Errorf("unexpected conflict %+v, version left at %d", conflict, stale.ResourceVersion)
+	}
+
+	if err := UpdateVersion(db, obj, map[string]interface{}{"status": "patched"}); err != nil {
+		t.Fatal(err)
+	}
+	if obj.ResourceVersion != 3 || obj.Status != "patched" {
+		t.Errorf("got %+v, want the patched object at version 3", obj)
+	}
+
+	missing := &testObject{ObjectMeta: metav1.ObjectMeta{ID: 42, ResourceVersion: 1}}
+	if err := UpdateVersion(db, missing, missing); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	stale.ResourceVersion = 0
+	if err := UpdateVersion(db, &stale, &stale); !errors.Is(err, ErrMissingResourceVersion) {
+		t.Errorf("got %v, want %v", err, ErrMissingResourceVersion)
+	}
+	if err := UpdateUnconditionally(db, &stale, &stale); err != nil {
+		t.Fatal(err)
+	}
+	if v := storedVersion(t, db, obj.ID); v != 4 {
+		t.Errorf("stored version %d, want 4", v)
+	}
+}
+
+func TestUpdateVersionKeepsSystemColumns(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+	obj := createObjects(t, db, "a")[0]
+	createdAt := obj.CreatedAt
+
+	update := &testObject{ObjectMeta: metav1.ObjectMeta{ID: obj.ID, Name: "a", ResourceVersion: 1}, Status: "updated"}
+	if err := UpdateVersion(db, update, update); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored testObject
+	if err := db.First(&stored, obj.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.InstanceID != "obj-a" || !stored.CreatedAt.Equal(createdAt) || stored.Status != "updated" {
+		t.Errorf("unexpected stored object %+v", stored)
+	}
+}
+
+func TestUpdateVersionStoresExtend(t *testing.T) {
+	provider, err := metav1.NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := newTestDB(t, &testObject{})
+	if err := encrypted.Use(metav1.NewEncryptionPlugin(metav1.NewEncryptor(provider))); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, db := range map[string]*gorm.DB{"plaintext": newTestDB(t, &testObject{}), "encrypted": encrypted} {
+		t.Run(name, func(t *testing.T) {
+			obj := createObjects(t, db, "a")[0]
+
+			obj.Extend = metav1.Extend{"owner": "alice"}
+			if err := UpdateVersion(db, obj, obj); err != nil {
+				t.Fatal(err)
+			}
+			var stored testObject
+			if err := db.First(&stored, obj.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Extend["owner"] != "alice" {
+				t.Errorf("got extend %v, want the updated one", stored.Extend)
+			}
+
+			var shadow string
+			if err := db.Model(&testObject{}).Where("id = ?", obj.ID).Pluck("extendShadow", &shadow).Error; err != nil {
+				t.Fatal(err)
+			}
+			if metav1.IsEncrypted(shadow) != (name == "encrypted") {
+				t.Errorf("extendShadow stored as %q", shadow)
+			}
+		})
+	}
+}
+
+func TestResourceVersionIncrements(t *testing.T) {
+	db := newTestDB(t, &testObject{})
+
+	tests := []struct {
+		name   string
+		update func(db *gorm.DB, obj *testObject) error
+	}{
+		{"save", func(db *gorm.DB, obj *testObject) error {
+			obj.Status = "saved"
+
+			return db.Save(obj).Error
+		}},
+		{"update", func(db *gorm.DB, obj *testObject) error {
+			return db.Model(obj).Update("status", "updated").Error
+		}},
+		{"updates by struct", func(db *gorm.DB, obj *testObject) error {
+			return db.Model(obj).Updates(&testObject{Status: "updated"}).Error
+		}},
+		{"updates by map", func(db *gorm.DB, obj *testObject) error {
+			return db.Model(obj).Updates(map[string]interface{}{"status": "updated"}).Error
+		}},
+		{"selected columns", func(db *gorm.DB, obj *testObject) error {
+			obj.Status = "updated"
+
+			return db.Model(obj).Select("status").Updates(obj).Error
+		}},
+		{"version set by the update", func(db *gorm.DB, obj *testObject) error {
+			return db.Model(obj).Updates(map[string]interface{}{"status": "updated", "resourceVersion": 7}).Error
+		}},
+		{"update columns", func(db *gorm.DB, obj *testObject) error {
+			return db.Model(obj).UpdateColumns(map[string]interface{}{"status": "updated"}).Error
+		}},
+		{"soft delete", func(db *gorm.DB, obj *testObject) error {
+			return db.Delete(obj).Error
+		}},
+		{"restore", func(db *gorm.DB, obj *testObject) error {
+			if err := db.Delete(&testObject{}, obj.ID).Error; err != nil {
+				return err
+			}
+
+			return Restore(db, &testObject{}, "id = ?", obj.ID)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := createObjects(t, db, tt.name)[0]
+			before := time.Now()
+
+			if err := tt.update(db, obj); err != nil {
+				t.Fatal(err)
+			}
+			want := uint64(2)
+			if tt.name == "restore" {
+				// the soft delete increments it too
+				want = 3
+			}
+			if v := storedVersion(t, db, obj.ID); v != want {
+				t.Errorf("stored version %d, want %d", v, want)
+			}
+			if tt.name != "restore" && obj.ResourceVersion != 2 {
+				t.Errorf("got version %d, want 2", obj.ResourceVersion)
+			}
+			if tt.name == "soft delete" && (!obj.DeletedAt.Valid || obj.DeletedAt.Time.Before(before.Add(-time.Second))) {
+				t.Errorf("got deletedAt %v", obj.DeletedAt)
+			}
+		})
+	}
+
+	obj := createObjects(t, db, "hard delete")[0]
+	if err := db.Unscoped().Delete(obj).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().First(&testObject{}, obj.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
@@ -35,7 +35,9 @@ func GetLocalIP() string {
 	return "127.0.0.1"
 }
 
-// RemoteIP returns the remote ip of the request.
+// RemoteIP returns the remote ip of the request, as claimed by the headers
+// X-Client-IP, X-Real-IP and X-Forwarded-For. They are set by the client, so
+// the ip is untrusted: use TrustedProxies.ClientIP for access control or logging.
 func RemoteIP(req *http.Request) string {
 	remoteAddr := req.RemoteAddr
 	if ip := req.Header.Get(XClientIP); ip != "" {
@@ -55,6 +57,61 @@ func RemoteIP(req *http.Request) string {
 	return remoteAddr
 }
 
+// TrustedProxies are the networks of the reverse proxies whose X-Forwarded-For
+// header is trusted.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses the CIDR ranges of the trusted reverse proxies.
+func ParseTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+
+	return proxies, nil
+}
+
+// Contains reports whether ip is the address of a trusted proxy.
+func (p TrustedProxies) Contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range p {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the IP of the client of req. The headers set by clients are
+// ignored, only if the peer address of req is a trusted proxy X-Forwarded-For
+// is walked from the right, and the first address which is not a trusted
+// proxy is returned.
+func (p TrustedProxies) ClientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+
+	hops := strings.Split(req.Header.Get(XForwardedFor), ",")
+	for i := len(hops) - 1; i >= 0 && p.Contains(ip); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		ip = hop
+	}
+
+	return ip
+}
+
 // GetFreePort gets a free port.
 func GetFreePort() (port int, err error) {
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -130,6 +187,31 @@ func ConvertMap2String(meta map[string]string) string {
 	return buf.String()
 }
 
+// ConvertValues2String encodes values in the form "a=1&a=2&b=3", sorted by key
+// and then by value, so it can be used as canonical query string.
+func ConvertValues2String(values url.Values) string {
+	var buf strings.Builder
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		keyEscaped := url.QueryEscape(k)
+		for _, v := range vs {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(keyEscaped)
+			buf.WriteByte('=')
+			buf.WriteString(url.QueryEscape(v))
+		}
+	}
+	return buf.String()
+}
+
 // ExternalIPV4 gets external IPv4 address of this server.
 func ExternalIPV4() (string, error) {
 	ifaces, err := net.Interfaces()
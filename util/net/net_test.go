@@ -0,0 +1,51 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("192.168.0.0/16", "fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		proxies      TrustedProxies
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"peer", proxies, "10.1.1.1:1234", "", "10.1.1.1"},
+		{"untrusted peer", proxies, "8.8.8.8:1234", "10.1.1.1", "8.8.8.8"},
+		{"no trusted proxies", nil, "192.168.1.1:1234", "10.1.1.1", "192.168.1.1"},
+		{"client behind proxy", proxies, "192.168.1.1:1234", "10.1.1.1", "10.1.1.1"},
+		{"client behind proxies", proxies, "192.168.1.1:1234", "10.1.1.1, 192.168.2.2", "10.1.1.1"},
+		{"spoofed client behind proxy", proxies, "192.168.1.1:1234", "10.1.1.1, 8.8.8.8", "8.8.8.8"},
+		{"ipv6 proxy", proxies, "[fd00::1]:1234", "10.1.1.1", "10.1.1.1"},
+		{"only proxies", proxies, "192.168.1.1:1234", "192.168.2.2", "192.168.2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set(XRealIP, "10.9.9.9")
+			if tt.forwardedFor != "" {
+				r.Header.Set(XForwardedFor, tt.forwardedFor)
+			}
+
+			if got := tt.proxies.ClientIP(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := ParseTrustedProxies("192.168.0.0/16", "192.168.0.1"); err == nil {
+		t.Error("parsed an IP without prefix length")
+	}
+}
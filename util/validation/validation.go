@@ -0,0 +1,91 @@
+// Package validation validates the keys and values of labels and annotations.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Define the limits of qualified names, label values and annotations.
+const (
+	QualifiedNameMaxLength = 63
+	PrefixMaxLength        = 253
+	LabelValueMaxLength    = 63
+
+	// TotalAnnotationSizeLimit is the maximum size of the keys and values of all annotations.
+	TotalAnnotationSizeLimit = 256 * 1024
+)
+
+var (
+	nameRegexp   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	prefixRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// IsQualifiedName returns an error if name is not an optional DNS subdomain
+// prefix and '/', followed by a name of at most 63 alphanumeric characters,
+// '-', '_' or '.', starting and ending with an alphanumeric character.
+// Label and annotation keys are qualified names.
+func IsQualifiedName(name string) error {
+	short := name
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		prefix := name[:i]
+		short = name[i+1:]
+		if len(prefix) == 0 || len(prefix) > PrefixMaxLength || !prefixRegexp.MatchString(prefix) {
+			return fmt.Errorf("invalid prefix %q of %q: must be a lower case DNS subdomain of at most %d characters",
+				prefix, name, PrefixMaxLength)
+		}
+	}
+	if len(short) == 0 || len(short) > QualifiedNameMaxLength || !nameRegexp.MatchString(short) {
+		return fmt.Errorf("invalid name %q: must be at most %d alphanumeric characters, "+
+			"'-', '_' or '.', starting and ending with an alphanumeric character", name, QualifiedNameMaxLength)
+	}
+
+	return nil
+}
+
+// IsValidLabelValue returns an error if value is not empty, or at most 63
+// alphanumeric characters, '-', '_' or '.', starting and ending with an
+// alphanumeric character.
+func IsValidLabelValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > LabelValueMaxLength || !nameRegexp.MatchString(value) {
+		return fmt.Errorf("invalid label value %q: must be at most %d alphanumeric characters, "+
+			"'-', '_' or '.', starting and ending with an alphanumeric character", value, LabelValueMaxLength)
+	}
+
+	return nil
+}
+
+// ValidateLabels validates the keys and values of labels.
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if err := IsQualifiedName(k); err != nil {
+			return fmt.Errorf("invalid label key: %w", err)
+		}
+		if err := IsValidLabelValue(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateAnnotations validates the keys of annotations and their total size,
+// the values are free form.
+func ValidateAnnotations(annotations map[string]string) error {
+	var size int
+	for k, v := range annotations {
+		if err := IsQualifiedName(k); err != nil {
+			return fmt.Errorf("invalid annotation key: %w", err)
+		}
+		size += len(k) + len(v)
+	}
+	if size > TotalAnnotationSizeLimit {
+		return fmt.Errorf("annotations are %d bytes, must be at most %d bytes", size, TotalAnnotationSizeLimit)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKeys(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"app", true},
+		{"App.Name_1", true},
+		{"example.com/app", true},
+		{"Example.com/app", false},
+		{"/app", false},
+		{"app-", false},
+		{strings.Repeat("a", QualifiedNameMaxLength+1), false},
+	}
+
+	// labels and annotations have the same keys
+	for _, tt := range tests {
+		if err := ValidateLabels(map[string]string{tt.key: "v"}); (err == nil) != tt.valid {
+			t.Errorf("ValidateLabels(%q) = %v, want valid %v", tt.key, err, tt.valid)
+		}
+		if err := ValidateAnnotations(map[string]string{tt.key: "v"}); (err == nil) != tt.valid {
+			t.Errorf("ValidateAnnotations(%q) = %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateAnnotationsSize(t *testing.T) {
+	annotations := map[string]string{"a": strings.Repeat("v", TotalAnnotationSizeLimit)}
+	if err := ValidateAnnotations(annotations); err == nil {
+		t.Fatal("ValidateAnnotations() accepted annotations over the size limit")
+	}
+}